@@ -0,0 +1,156 @@
+package keyaudit
+
+import (
+	"context"
+	"errors"
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+var _ Sink = (*AsyncSink)(nil)
+
+// ErrSinkClosed is returned when writing to a closed AsyncSink.
+var ErrSinkClosed = errors.New("audit sink is closed")
+
+// AsyncSink buffers the events and writes them to the underlying sink in the background.
+// When the buffer is full, events are dropped, or, with WithBlocking, the caller waits for free space.
+// Dropped events are counted in Dropped and recorded with the keymetrics.Recorder set with WithMetrics.
+type AsyncSink struct {
+	sink    Sink
+	events  chan Event
+	block   bool
+	onDrop  func(Event)
+	metrics keymetrics.Recorder
+	logger  *slog.Logger
+	dropped atomic.Uint64
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+// AsyncOption configures an AsyncSink.
+type AsyncOption func(*AsyncSink)
+
+// WithBlocking makes Write wait for free buffer space until the context is done instead of dropping the event.
+func WithBlocking() AsyncOption {
+	return func(s *AsyncSink) {
+		s.block = true
+	}
+}
+
+// WithMetrics sets the Recorder of the dropped events. By default, drops are only counted in Dropped.
+//
+// Example:
+//
+//	recorder := keyprom.New(prometheus.DefaultRegisterer)
+//	sink := NewAsyncSink(fileSink, 1024, WithMetrics(recorder))
+func WithMetrics(recorder keymetrics.Recorder) AsyncOption {
+	return func(s *AsyncSink) {
+		s.metrics = recorder
+	}
+}
+
+// WithOnDrop sets a function called for every dropped event, e.g. to log it.
+func WithOnDrop(onDrop func(Event)) AsyncOption {
+	return func(s *AsyncSink) {
+		s.onDrop = onDrop
+	}
+}
+
+// WithErrorLogger sets the logger of the underlying sink's errors. By default, errors are logged to stdout.
+func WithErrorLogger(logger *slog.Logger) AsyncOption {
+	return func(s *AsyncSink) {
+		s.logger = logger
+	}
+}
+
+// NewAsyncSink starts writing the events buffered up to the given size to the sink.
+// Close must be called to flush the buffer.
+func NewAsyncSink(sink Sink, size int, opts ...AsyncOption) *AsyncSink {
+	s := &AsyncSink{
+		sink:    sink,
+		events:  make(chan Event, size),
+		metrics: keymetrics.Nop,
+		logger:  slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	go s.run()
+	return s
+}
+
+// Write buffers the event. A dropped event isn't reported as an error, but counted in Dropped.
+func (s *AsyncSink) Write(ctx context.Context, event Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrSinkClosed
+	}
+
+	if s.block {
+		select {
+		case s.events <- event:
+			return nil
+		case <-ctx.Done():
+			s.drop(event)
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		s.drop(event)
+	}
+	return nil
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *AsyncSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops accepting events and waits until the buffered ones are written or the context is done.
+func (s *AsyncSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run writes the buffered events to the sink until the sink is closed.
+func (s *AsyncSink) run() {
+	defer close(s.done)
+
+	for event := range s.events {
+		if err := s.sink.Write(context.Background(), event); err != nil {
+			s.logger.Error("Failed to write audit event", slog.String("err", err.Error()))
+		}
+	}
+}
+
+// drop counts the dropped event and records it in the metrics.
+func (s *AsyncSink) drop(event Event) {
+	s.dropped.Add(1)
+	s.metrics.AuditDropped(event.Decision)
+	if s.onDrop != nil {
+		s.onDrop(event)
+	}
+}
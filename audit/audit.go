@@ -0,0 +1,75 @@
+// Package keyaudit records the access decisions of the authentication provider for auditing.
+package keyaudit
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Decisions of an Event.
+const (
+	DecisionAllowed = "allowed"
+	DecisionDenied  = "denied"
+)
+
+// Event describes an access decision.
+type Event struct {
+	// Time is when the decision was made.
+	Time time.Time `json:"time"`
+
+	// Subject is the ID of the user or service account.
+	Subject string `json:"subject,omitempty"`
+
+	// ClientID is the ID of the client that obtained the token.
+	ClientID string `json:"client_id,omitempty"`
+
+	// Realm is the name of the realm that issued the token.
+	Realm string `json:"realm,omitempty"`
+
+	// Transport is "http" or "grpc".
+	Transport string `json:"transport"`
+
+	// Endpoint is the HTTP method and path or the full gRPC method name.
+	Endpoint string `json:"endpoint"`
+
+	// RequiredRoles are the roles required by the endpoint.
+	RequiredRoles []string `json:"required_roles,omitempty"`
+
+	// PresentRoles are the roles of the user.
+	PresentRoles []string `json:"present_roles,omitempty"`
+
+	// Decision is DecisionAllowed or DecisionDenied.
+	Decision string `json:"decision"`
+
+	// Reason explains a denial, e.g. "invalid_token" or "access_denied".
+	Reason string `json:"reason,omitempty"`
+
+	// TokenID is the jti claim of the token.
+	TokenID string `json:"jti,omitempty"`
+}
+
+// Sink receives the decision events. Write is called on the request path, so slow sinks should be
+// wrapped with NewAsyncSink. Implementations must be safe for concurrent use.
+type Sink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(ctx context.Context, event Event) error
+
+// Write calls f.
+func (f SinkFunc) Write(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// Sample returns a Sink passing every denial but only the given fraction of allow decisions to the sink,
+// e.g. 0.1 for every tenth one on average.
+func Sample(sink Sink, allowRate float64) Sink {
+	return SinkFunc(func(ctx context.Context, event Event) error {
+		if event.Decision == DecisionAllowed && rand.Float64() >= allowRate {
+			return nil
+		}
+		return sink.Write(ctx, event)
+	})
+}
@@ -0,0 +1,132 @@
+package keyaudit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memorySink collects the events in memory.
+type memorySink struct {
+	mu      sync.Mutex
+	events  []Event
+	release chan struct{}
+}
+
+func (s *memorySink) Write(_ context.Context, event Event) error {
+	if s.release != nil {
+		<-s.release
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memorySink) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+// dropRecorder counts the dropped audit events by decision.
+type dropRecorder struct {
+	keymetrics.Recorder
+
+	mu      sync.Mutex
+	dropped map[string]int
+}
+
+func (r *dropRecorder) AuditDropped(decision string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dropped[decision]++
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+
+	events := []Event{
+		{Time: time.Unix(1700000000, 0).UTC(), Subject: "jdoe", Transport: "http", Endpoint: "GET /api", Decision: DecisionAllowed},
+		{Time: time.Unix(1700000001, 0).UTC(), Transport: "grpc", Endpoint: "/svc/Method", Decision: DecisionDenied, Reason: "invalid_token"},
+	}
+	for _, event := range events {
+		require.NoError(t, sink.Write(context.Background(), event))
+	}
+	require.NoError(t, sink.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var written []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		written = append(written, event)
+	}
+	assert.Equal(t, events, written)
+}
+
+func TestAsyncSink(t *testing.T) {
+	t.Run("Drops when the buffer is full", func(t *testing.T) {
+		sink := &memorySink{release: make(chan struct{})}
+		var dropped []Event
+		recorder := &dropRecorder{Recorder: keymetrics.Nop, dropped: make(map[string]int)}
+		async := NewAsyncSink(sink, 1, WithMetrics(recorder), WithOnDrop(func(event Event) { dropped = append(dropped, event) }))
+
+		// The first event is taken by the writer, the second fills the buffer.
+		require.NoError(t, async.Write(context.Background(), Event{Endpoint: "1"}))
+		require.Eventually(t, func() bool { return len(async.events) == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, async.Write(context.Background(), Event{Endpoint: "2"}))
+		require.NoError(t, async.Write(context.Background(), Event{Endpoint: "3", Decision: DecisionDenied}))
+
+		assert.Equal(t, uint64(1), async.Dropped())
+		assert.Equal(t, []Event{{Endpoint: "3", Decision: DecisionDenied}}, dropped)
+		assert.Equal(t, map[string]int{DecisionDenied: 1}, recorder.dropped)
+
+		close(sink.release)
+		require.NoError(t, async.Close(context.Background()))
+		assert.Equal(t, 2, sink.len())
+		require.ErrorIs(t, async.Write(context.Background(), Event{}), ErrSinkClosed)
+	})
+
+	t.Run("Blocks until the context is done", func(t *testing.T) {
+		sink := &memorySink{release: make(chan struct{})}
+		async := NewAsyncSink(sink, 0, WithBlocking())
+
+		// The first event is taken by the writer, which waits for the release.
+		require.NoError(t, async.Write(context.Background(), Event{}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, async.Write(ctx, Event{}), context.DeadlineExceeded)
+		assert.Equal(t, uint64(1), async.Dropped())
+
+		close(sink.release)
+		require.NoError(t, async.Close(context.Background()))
+	})
+}
+
+func TestSample(t *testing.T) {
+	sink := &memorySink{}
+	sampled := Sample(sink, 0)
+
+	require.NoError(t, sampled.Write(context.Background(), Event{Decision: DecisionAllowed}))
+	require.NoError(t, sampled.Write(context.Background(), Event{Decision: DecisionDenied}))
+	assert.Equal(t, []Event{{Decision: DecisionDenied}}, sink.events)
+
+	require.NoError(t, Sample(sink, 1).Write(context.Background(), Event{Decision: DecisionAllowed}))
+	assert.Equal(t, 2, sink.len())
+}
@@ -0,0 +1,42 @@
+package keyaudit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+var _ Sink = (*FileSink)(nil)
+
+// FileSink appends the events to a file as JSON lines.
+type FileSink struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// NewFileSink opens the file for appending, creating it if necessary.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Write appends the event as a JSON line.
+func (s *FileSink) Write(_ context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.encoder.Encode(event)
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
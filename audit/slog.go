@@ -0,0 +1,26 @@
+package keyaudit
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogSink returns a Sink logging the events with the logger at info level.
+func NewSlogSink(logger *slog.Logger) Sink {
+	return SinkFunc(func(ctx context.Context, event Event) error {
+		logger.LogAttrs(ctx, slog.LevelInfo, "Access decision",
+			slog.Time("time", event.Time),
+			slog.String("subject", event.Subject),
+			slog.String("client_id", event.ClientID),
+			slog.String("realm", event.Realm),
+			slog.String("transport", event.Transport),
+			slog.String("endpoint", event.Endpoint),
+			slog.Any("required_roles", event.RequiredRoles),
+			slog.Any("present_roles", event.PresentRoles),
+			slog.String("decision", event.Decision),
+			slog.String("reason", event.Reason),
+			slog.String("jti", event.TokenID),
+		)
+		return nil
+	})
+}
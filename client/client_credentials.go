@@ -0,0 +1,209 @@
+package keyclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	keyimpl "github.com/YATAHAKI/KeycloakAuth/impl"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redis key prefix of the shared client credentials tokens
+const _clientTokenPrefix = "client-token:"
+
+var _ TokenSource = (*ClientCredentialsSource)(nil)
+
+// ClientCredentialsSource obtains service-account tokens with the client credentials grant.
+// Tokens are cached in memory and, if a Redis client is given, shared across replicas.
+// A token is refreshed Config.TokenRefreshSkew before it expires, and concurrent callers
+// share a single request to the token endpoint.
+type ClientCredentialsSource struct {
+	// Config
+	config *keyimpl.Config
+
+	// Token endpoint client
+	endpoint *endpoint
+
+	// Redis client, nil when tokens aren't shared
+	redis *redis.Client
+
+	// Redis key of the shared token
+	sharedKey string
+
+	// Logger
+	logger *slog.Logger
+
+	// Cached token and the in-flight token request
+	mu     sync.Mutex
+	token  *Token
+	flight *flight
+}
+
+// flight represents a token request shared by concurrent callers.
+type flight struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// NewClientCredentialsSource creates a token source for the client configured in config.
+// The client authenticates with Config.ClientSecret or, if a client assertion key is configured, with private_key_jwt.
+//
+// Parameters:
+//   - config: Configuration settings with the client credentials and token endpoint
+//   - redis: Redis client used to share tokens across replicas, may be nil
+//   - opts: Optional settings, e.g. WithHTTPClient
+//
+// Example:
+//
+//	source, err := NewClientCredentialsSource(config, redisClient)
+//	token, err := source.Token(ctx)
+func NewClientCredentialsSource(config *keyimpl.Config, redis *redis.Client, opts ...Option) (*ClientCredentialsSource, error) {
+	o := defaultOptions(opts)
+
+	endpoint, err := newEndpoint(config, o.httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientCredentialsSource{
+		config:    config,
+		endpoint:  endpoint,
+		redis:     redis,
+		sharedKey: sharedTokenKey(config),
+		logger:    o.logger,
+	}, nil
+}
+
+// sharedTokenKey returns the Redis key of the shared token. Besides the client ID, it includes a hash of
+// the token endpoint and the requested scopes, so sources of the same client in different realms or with
+// different scopes don't share tokens.
+func sharedTokenKey(config *keyimpl.Config) string {
+	scopes := slices.Clone(config.TokenScopes)
+	slices.Sort(scopes)
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		config.TokenURI,
+		config.IssuerURI,
+		strings.Join(scopes, " "),
+	}, "\n")))
+	return _clientTokenPrefix + config.ClientID + ":" + hex.EncodeToString(sum[:16])
+}
+
+// Token returns the cached token or obtains a new one if it is about to expire.
+func (s *ClientCredentialsSource) Token(ctx context.Context) (*Token, error) {
+	return s.get(ctx, false)
+}
+
+// Refresh discards the cached token, including the one shared in Redis, and obtains a new one.
+func (s *ClientCredentialsSource) Refresh(ctx context.Context) (*Token, error) {
+	return s.get(ctx, true)
+}
+
+// get returns the cached token or joins the in-flight token request, starting one if needed.
+func (s *ClientCredentialsSource) get(ctx context.Context, force bool) (*Token, error) {
+	s.mu.Lock()
+	if force && s.flight == nil {
+		s.token = nil
+	}
+	if s.token.Valid(s.skew()) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	f := s.flight
+	if f == nil {
+		f = &flight{done: make(chan struct{})}
+		s.flight = f
+		go s.fetch(context.WithoutCancel(ctx), f, !force)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fetch obtains a token from Redis or the token endpoint and completes the flight.
+func (s *ClientCredentialsSource) fetch(ctx context.Context, f *flight, useShared bool) {
+	if useShared {
+		f.token = s.loadShared(ctx)
+	}
+	if f.token == nil {
+		form := url.Values{"grant_type": {"client_credentials"}}
+		if len(s.config.TokenScopes) > 0 {
+			form.Set("scope", strings.Join(s.config.TokenScopes, " "))
+		}
+
+		f.token, f.err = s.endpoint.request(ctx, form)
+		if f.err == nil {
+			s.logger.Info("Fetching client token from remote", slog.String("client", s.config.ClientID))
+			s.storeShared(ctx, f.token)
+		} else {
+			s.logger.Error("Failed to fetch client token", slog.String("err", f.err.Error()))
+		}
+	}
+
+	s.mu.Lock()
+	if f.err == nil {
+		s.token = f.token
+	}
+	s.flight = nil
+	s.mu.Unlock()
+	close(f.done)
+}
+
+// loadShared returns the token shared in Redis, or nil if there's no valid one.
+func (s *ClientCredentialsSource) loadShared(ctx context.Context) *Token {
+	if s.redis == nil {
+		return nil
+	}
+
+	result, err := s.redis.Get(ctx, s.sharedKey).Result()
+	if err != nil {
+		return nil
+	}
+
+	var token Token
+	if err = json.Unmarshal([]byte(result), &token); err != nil || !token.Valid(s.skew()) {
+		return nil
+	}
+
+	s.logger.Info("Getting client token from cache", slog.String("client", s.config.ClientID))
+	return &token
+}
+
+// storeShared shares the token in Redis until it is due for refresh.
+func (s *ClientCredentialsSource) storeShared(ctx context.Context, token *Token) {
+	ttl := token.refreshIn(s.skew())
+	if s.redis == nil || ttl <= 0 {
+		return
+	}
+
+	serialized, err := json.Marshal(token)
+	if err != nil {
+		return
+	}
+
+	if err = s.redis.Set(ctx, s.sharedKey, serialized, ttl).Err(); err != nil {
+		s.logger.Error("Failed to share client token", slog.String("err", err.Error()))
+	}
+}
+
+// skew returns how long before expiry a token is refreshed.
+func (s *ClientCredentialsSource) skew() time.Duration {
+	if s.config.TokenRefreshSkew > 0 {
+		return s.config.TokenRefreshSkew
+	}
+	return 30 * time.Second
+}
@@ -0,0 +1,298 @@
+package keyclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	keyimpl "github.com/YATAHAKI/KeycloakAuth/impl"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer is a local stand-in for the Keycloak token endpoint.
+type tokenServer struct {
+	*httptest.Server
+
+	// Number of token requests served
+	requests atomic.Int32
+
+	// Lifetime of the issued tokens
+	expiresIn int
+
+	// Delay before answering, to let concurrent callers pile up
+	delay time.Duration
+
+	// Checks the client authentication of a token request
+	authenticate func(r *http.Request) error
+}
+
+func newTokenServer(t *testing.T) *tokenServer {
+	s := &tokenServer{expiresIn: 300}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /realms/test/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":         s.URL + "/realms/test",
+			"token_endpoint": s.URL + "/realms/test/protocol/openid-connect/token",
+		})
+	})
+	mux.HandleFunc("POST /realms/test/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		n := s.requests.Add(1)
+		time.Sleep(s.delay)
+
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		prefix := "token"
+		switch r.PostForm.Get("grant_type") {
+		case "client_credentials":
+		case _tokenExchangeGrant:
+			if r.PostForm.Get("subject_token") == "" || r.PostForm.Get("subject_token_type") != _accessTokenTokenType {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = fmt.Fprint(w, `{"error":"invalid_request"}`)
+				return
+			}
+			prefix = r.PostForm.Get("audience")
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `{"error":"unsupported_grant_type"}`)
+			return
+		}
+		if s.authenticate != nil {
+			if err := s.authenticate(r); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = fmt.Fprintf(w, `{"error":"invalid_client","error_description":%q}`, err.Error())
+				return
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("%s-%d", prefix, n),
+			"token_type":   "Bearer",
+			"expires_in":   s.expiresIn,
+			"scope":        r.PostForm.Get("scope"),
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestClientCredentialsSource_Token(t *testing.T) {
+	server := newTokenServer(t)
+	server.authenticate = func(r *http.Request) error {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "billing" || secret != "s3cret" {
+			return errors.New("bad credentials")
+		}
+		return nil
+	}
+
+	source, err := NewClientCredentialsSource(&keyimpl.Config{
+		IssuerURI:    server.URL + "/realms/test",
+		ClientID:     "billing",
+		ClientSecret: "s3cret",
+		TokenScopes:  []string{"invoices", "payments"},
+	}, nil)
+	require.NoError(t, err)
+
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+	assert.Equal(t, "invoices payments", token.Scope)
+	assert.WithinDuration(t, time.Now().Add(300*time.Second), token.ExpiresAt, 5*time.Second)
+
+	token, err = source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken, "cached token expected")
+
+	token, err = source.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken)
+	assert.Equal(t, int32(2), server.requests.Load())
+}
+
+func TestClientCredentialsSource_RefreshBeforeExpiry(t *testing.T) {
+	server := newTokenServer(t)
+	server.expiresIn = 2
+
+	source, err := NewClientCredentialsSource(&keyimpl.Config{
+		TokenURI:         server.URL + "/realms/test/protocol/openid-connect/token",
+		ClientID:         "billing",
+		ClientSecret:     "s3cret",
+		TokenRefreshSkew: 30 * time.Second,
+	}, nil)
+	require.NoError(t, err)
+
+	for _, expected := range []string{"token-1", "token-1"} {
+		token, err := source.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, expected, token.AccessToken, "token shorter-lived than the skew is reused")
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken, "refreshed after half of its lifetime")
+}
+
+func TestClientCredentialsSource_NoExpiresIn(t *testing.T) {
+	server := newTokenServer(t)
+	server.expiresIn = 0
+
+	source, err := NewClientCredentialsSource(&keyimpl.Config{
+		TokenURI:     server.URL + "/realms/test/protocol/openid-connect/token",
+		ClientID:     "billing",
+		ClientSecret: "s3cret",
+	}, nil)
+	require.NoError(t, err)
+
+	for range 3 {
+		token, err := source.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", token.AccessToken)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), token.ExpiresAt, 5*time.Second)
+	}
+	assert.Equal(t, int32(1), server.requests.Load())
+}
+
+func TestClientCredentialsSource_SharedToken(t *testing.T) {
+	server := newTokenServer(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+
+	newSource := func(tokenURI string, scopes ...string) *ClientCredentialsSource {
+		source, err := NewClientCredentialsSource(&keyimpl.Config{
+			TokenURI:     tokenURI,
+			ClientID:     "billing",
+			ClientSecret: "s3cret",
+			TokenScopes:  scopes,
+		}, redisClient)
+		require.NoError(t, err)
+		return source
+	}
+	tokenURI := server.URL + "/realms/test/protocol/openid-connect/token"
+
+	token, err := newSource(tokenURI, "invoices", "payments").Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+
+	token, err = newSource(tokenURI, "payments", "invoices").Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken, "token shared by another replica expected")
+	assert.Equal(t, int32(1), server.requests.Load())
+
+	token, err = newSource(tokenURI, "invoices").Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken, "token with other scopes mustn't be shared")
+
+	token, err = newSource(tokenURI+"?realm=other", "invoices", "payments").Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-3", token.AccessToken, "token of other token endpoint mustn't be shared")
+}
+
+func TestClientCredentialsSource_SingleFlight(t *testing.T) {
+	server := newTokenServer(t)
+	server.delay = 100 * time.Millisecond
+
+	source, err := NewClientCredentialsSource(&keyimpl.Config{
+		TokenURI:     server.URL + "/realms/test/protocol/openid-connect/token",
+		ClientID:     "billing",
+		ClientSecret: "s3cret",
+	}, nil)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 20)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := source.Token(context.Background())
+			if assert.NoError(t, err) {
+				tokens[i] = token.AccessToken
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), server.requests.Load())
+	for _, token := range tokens {
+		assert.Equal(t, "token-1", token)
+	}
+}
+
+func TestClientCredentialsSource_PrivateKeyJWT(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	server := newTokenServer(t)
+	tokenURI := server.URL + "/realms/test/protocol/openid-connect/token"
+	server.authenticate = func(r *http.Request) error {
+		if r.PostForm.Get("client_assertion_type") != _clientAssertionType {
+			return errors.New("missing client assertion")
+		}
+		_, err := jwt.Parse(r.PostForm.Get("client_assertion"), func(token *jwt.Token) (interface{}, error) {
+			if token.Header["kid"] != "billing-key" {
+				return nil, errors.New("unexpected kid")
+			}
+			return &key.PublicKey, nil
+		},
+			jwt.WithValidMethods([]string{"ES256"}),
+			jwt.WithIssuer("billing"),
+			jwt.WithSubject("billing"),
+			jwt.WithAudience(tokenURI),
+			jwt.WithExpirationRequired(),
+		)
+		return err
+	}
+
+	source, err := NewClientCredentialsSource(&keyimpl.Config{
+		TokenURI:             tokenURI,
+		ClientID:             "billing",
+		ClientAssertionKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		ClientAssertionKeyID: "billing-key",
+	}, nil)
+	require.NoError(t, err)
+
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+}
+
+func TestClientCredentialsSource_TokenError(t *testing.T) {
+	server := newTokenServer(t)
+	server.authenticate = func(r *http.Request) error {
+		return errors.New("client disabled")
+	}
+
+	source, err := NewClientCredentialsSource(&keyimpl.Config{
+		TokenURI:     server.URL + "/realms/test/protocol/openid-connect/token",
+		ClientID:     "billing",
+		ClientSecret: "s3cret",
+	}, nil)
+	require.NoError(t, err)
+
+	_, err = source.Token(context.Background())
+	var tokenErr *TokenError
+	require.ErrorAs(t, err, &tokenErr)
+	assert.Equal(t, http.StatusUnauthorized, tokenErr.StatusCode)
+	assert.Equal(t, "invalid_client", tokenErr.Code)
+	assert.Equal(t, "client disabled", tokenErr.Description)
+}
@@ -0,0 +1,67 @@
+package keyclient
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+var _ credentials.PerRPCCredentials = (*PerRPCCredentials)(nil)
+
+// PerRPCCredentials attaches "authorization: Bearer" metadata to outgoing gRPC calls.
+type PerRPCCredentials struct {
+	outbound
+}
+
+// NewPerRPCCredentials creates gRPC call credentials backed by the token source.
+// The source may be nil when WithPassThrough is used and every call carries the caller's token.
+//
+// Example:
+//
+//	creds := NewPerRPCCredentials(source)
+//	conn, err := grpc.NewClient(target,
+//	    grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+//	    grpc.WithPerRPCCredentials(creds),
+//	    grpc.WithUnaryInterceptor(creds.UnaryClientInterceptor()),
+//	)
+func NewPerRPCCredentials(source TokenSource, opts ...Option) *PerRPCCredentials {
+	return &PerRPCCredentials{outbound{source: source, opts: defaultOptions(opts)}}
+}
+
+// GetRequestMetadata returns the authorization metadata for the call.
+func (c *PerRPCCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, _, err := c.token(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity reports whether the credentials require a secure connection.
+func (c *PerRPCCredentials) RequireTransportSecurity() bool {
+	return !c.opts.allowInsecure
+}
+
+// UnaryClientInterceptor returns an interceptor that retries a call once with a refreshed token
+// when the server answers with codes.Unauthenticated. Propagated tokens aren't retried.
+func (c *PerRPCCredentials) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+
+		if _, refreshable, tokenErr := c.token(ctx); tokenErr != nil || !refreshable {
+			return err
+		}
+
+		if _, refreshErr := c.refresh(ctx); refreshErr != nil {
+			return err
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
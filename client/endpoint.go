@@ -0,0 +1,187 @@
+package keyclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	keyimpl "github.com/YATAHAKI/KeycloakAuth/impl"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client assertion type for private_key_jwt client authentication (RFC 7523).
+const _clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// Lifetime assumed for tokens whose response has no positive expires_in
+const _defaultTokenLifetime = time.Minute
+
+// endpoint calls the token endpoint on behalf of the configured client.
+type endpoint struct {
+	// Config
+	config *keyimpl.Config
+
+	// HTTP client
+	httpClient *http.Client
+
+	// Private key and signing method for private_key_jwt, nil when the client secret is used
+	assertionKey    any
+	assertionMethod jwt.SigningMethod
+
+	// Token endpoint URI, resolved on first use
+	mu  sync.Mutex
+	uri string
+}
+
+// newEndpoint creates the token endpoint client and loads the client assertion key, if configured.
+func newEndpoint(config *keyimpl.Config, httpClient *http.Client) (*endpoint, error) {
+	e := &endpoint{
+		config:     config,
+		httpClient: httpClient,
+	}
+
+	keyPEM := []byte(config.ClientAssertionKey)
+	if len(keyPEM) == 0 && config.ClientAssertionKeyFile != "" {
+		var err error
+		if keyPEM, err = os.ReadFile(config.ClientAssertionKeyFile); err != nil {
+			return nil, fmt.Errorf("cannot read client assertion key: %w", err)
+		}
+	}
+	if len(keyPEM) == 0 {
+		return e, nil
+	}
+
+	if key, err := jwt.ParseRSAPrivateKeyFromPEM(keyPEM); err == nil {
+		e.assertionKey, e.assertionMethod = key, jwt.SigningMethodRS256
+		return e, nil
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse client assertion key: %w", err)
+	}
+	e.assertionKey = key
+	switch key.Curve.Params().BitSize {
+	case 384:
+		e.assertionMethod = jwt.SigningMethodES384
+	case 521:
+		e.assertionMethod = jwt.SigningMethodES512
+	default:
+		e.assertionMethod = jwt.SigningMethodES256
+	}
+
+	return e, nil
+}
+
+// resolve returns the token endpoint URI, discovering it on first use.
+func (e *endpoint) resolve(ctx context.Context) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.uri != "" {
+		return e.uri, nil
+	}
+
+	uri, err := e.config.TokenEndpoint(ctx, e.httpClient)
+	if err != nil {
+		return "", err
+	}
+
+	e.uri = uri
+	return uri, nil
+}
+
+// request sends the token request with the given grant parameters and client authentication.
+func (e *endpoint) request(ctx context.Context, form url.Values) (*Token, error) {
+	uri, err := e.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form.Set("client_id", e.config.ClientID)
+	if e.assertionKey != nil {
+		assertion, err := e.clientAssertion(uri)
+		if err != nil {
+			return nil, err
+		}
+		form.Set("client_assertion_type", _clientAssertionType)
+		form.Set("client_assertion", assertion)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if e.assertionKey == nil && e.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(e.config.ClientID), url.QueryEscape(e.config.ClientSecret))
+	}
+
+	issuedAt := time.Now()
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		tokenErr := &TokenError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(tokenErr)
+		return nil, tokenErr
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		Scope       string `json:"scope"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("cannot decode token response: %w", err)
+	}
+	if body.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access token")
+	}
+
+	lifetime := time.Duration(body.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = _defaultTokenLifetime
+	}
+
+	return &Token{
+		AccessToken: body.AccessToken,
+		TokenType:   body.TokenType,
+		Scope:       body.Scope,
+		ExpiresAt:   issuedAt.Add(lifetime),
+		IssuedAt:    issuedAt,
+	}, nil
+}
+
+// clientAssertion creates a signed JWT authenticating the client at the token endpoint.
+func (e *endpoint) clientAssertion(audience string) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(e.assertionMethod, jwt.RegisteredClaims{
+		Issuer:    e.config.ClientID,
+		Subject:   e.config.ClientID,
+		Audience:  jwt.ClaimStrings{audience},
+		ID:        hex.EncodeToString(jti),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	})
+	if e.config.ClientAssertionKeyID != "" {
+		token.Header["kid"] = e.config.ClientAssertionKeyID
+	}
+
+	return token.SignedString(e.assertionKey)
+}
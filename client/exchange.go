@@ -0,0 +1,271 @@
+package keyclient
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	keyimpl "github.com/YATAHAKI/KeycloakAuth/impl"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"github.com/golang-jwt/jwt/v5"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Token exchange grant and token types (RFC 8693).
+const (
+	_tokenExchangeGrant   = "urn:ietf:params:oauth:grant-type:token-exchange"
+	_accessTokenTokenType = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// Verifier verifies inbound access tokens. It is implemented by keyimpl.Provider.
+type Verifier interface {
+	// VerifyToken verifies the token string and returns the parsed token.
+	VerifyToken(ctx context.Context, tokenString string) (*jwt.Token, error)
+}
+
+// Maximum number of cached exchanged tokens
+const _exchangeCacheSize = 10000
+
+// exchangeEntry is a cached exchanged token.
+type exchangeEntry struct {
+	key   exchangeKey
+	token *Token
+}
+
+// exchangeKey identifies a cached exchanged token.
+type exchangeKey struct {
+	issuer   string
+	subject  string
+	audience string
+}
+
+// TokenExchanger exchanges verified inbound tokens for tokens issued to another audience (RFC 8693),
+// so a service can call a backend on behalf of the user without forwarding the original token.
+// Exchanged tokens are cached per (issuer, subject, audience) until they are due for refresh.
+// The cache holds at most 10000 tokens and evicts the least recently used ones.
+type TokenExchanger struct {
+	// Config
+	config *keyimpl.Config
+
+	// Token endpoint client
+	endpoint *endpoint
+
+	// Cached exchanged tokens, most recently used first, and the in-flight exchanges
+	mu      sync.Mutex
+	cache   map[exchangeKey]*list.Element
+	order   *list.List
+	maxSize int
+	flights map[exchangeKey]*flight
+}
+
+// NewTokenExchanger creates a token exchanger authenticating as the client configured in config.
+// The client must be permitted to exchange tokens for the target audiences in Keycloak.
+//
+// Example:
+//
+//	exchanger, err := NewTokenExchanger(config)
+//	token, err := exchanger.Exchange(ctx, verifiedToken, "invoice-service")
+func NewTokenExchanger(config *keyimpl.Config, opts ...Option) (*TokenExchanger, error) {
+	o := defaultOptions(opts)
+
+	endpoint, err := newEndpoint(config, o.httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenExchanger{
+		config:   config,
+		endpoint: endpoint,
+		cache:    make(map[exchangeKey]*list.Element),
+		order:    list.New(),
+		maxSize:  _exchangeCacheSize,
+		flights:  make(map[exchangeKey]*flight),
+	}, nil
+}
+
+// Exchange returns a token for the audience on behalf of the subject of the token.
+// The token must have been verified with VerifyToken. Concurrent callers exchanging a token of the same
+// subject for the same audience share a single request to the token endpoint.
+func (e *TokenExchanger) Exchange(ctx context.Context, token *jwt.Token, audience string) (*Token, error) {
+	key, err := newExchangeKey(token, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	if cached := e.get(key); cached != nil {
+		e.mu.Unlock()
+		return cached, nil
+	}
+	f := e.flights[key]
+	if f == nil {
+		f = &flight{done: make(chan struct{})}
+		e.flights[key] = f
+		go e.exchange(context.WithoutCancel(ctx), f, key, token.Raw)
+	}
+	e.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// exchange requests the exchanged token from the token endpoint, caches it and completes the flight.
+func (e *TokenExchanger) exchange(ctx context.Context, f *flight, key exchangeKey, subjectToken string) {
+	f.token, f.err = e.endpoint.request(ctx, url.Values{
+		"grant_type":           {_tokenExchangeGrant},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {_accessTokenTokenType},
+		"requested_token_type": {_accessTokenTokenType},
+		"audience":             {key.audience},
+	})
+
+	e.mu.Lock()
+	if f.err == nil {
+		e.put(key, f.token)
+	}
+	delete(e.flights, key)
+	e.mu.Unlock()
+	close(f.done)
+}
+
+// Invalidate drops the cached tokens of the subject for the audience, whatever realm issued the subject token.
+func (e *TokenExchanger) Invalidate(subject, audience string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for key, element := range e.cache {
+		if key.subject == subject && key.audience == audience {
+			e.remove(element)
+		}
+	}
+}
+
+// invalidate drops the cached token.
+func (e *TokenExchanger) invalidate(key exchangeKey) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if element, ok := e.cache[key]; ok {
+		e.remove(element)
+	}
+}
+
+// get returns the cached token if it isn't due for refresh and marks it as recently used.
+// A token due for refresh is removed. Must be called with mu held.
+func (e *TokenExchanger) get(key exchangeKey) *Token {
+	element, ok := e.cache[key]
+	if !ok {
+		return nil
+	}
+
+	entry := element.Value.(*exchangeEntry)
+	if !entry.token.Valid(e.skew()) {
+		e.remove(element)
+		return nil
+	}
+	e.order.MoveToFront(element)
+	return entry.token
+}
+
+// put caches the token, evicting the least recently used tokens above the maximum size.
+// Must be called with mu held.
+func (e *TokenExchanger) put(key exchangeKey, token *Token) {
+	if element, ok := e.cache[key]; ok {
+		element.Value.(*exchangeEntry).token = token
+		e.order.MoveToFront(element)
+		return
+	}
+
+	e.cache[key] = e.order.PushFront(&exchangeEntry{key: key, token: token})
+	for e.order.Len() > e.maxSize {
+		e.remove(e.order.Back())
+	}
+}
+
+// remove removes the element. Must be called with mu held.
+func (e *TokenExchanger) remove(element *list.Element) {
+	e.order.Remove(element)
+	delete(e.cache, element.Value.(*exchangeEntry).key)
+}
+
+// newExchangeKey returns the cache key of the token exchanged for the audience. The issuer is part of the key,
+// since subjects of different realms may collide.
+func newExchangeKey(token *jwt.Token, audience string) (exchangeKey, error) {
+	subject, err := token.Claims.GetSubject()
+	if err != nil || subject == "" {
+		return exchangeKey{}, fmt.Errorf("token has no subject")
+	}
+	issuer, err := token.Claims.GetIssuer()
+	if err != nil {
+		return exchangeKey{}, fmt.Errorf("token has invalid issuer: %w", err)
+	}
+
+	return exchangeKey{issuer: issuer, subject: subject, audience: audience}, nil
+}
+
+// Source returns a TokenSource that exchanges the caller's token stored in the context
+// under provider.AccessTokenKey for the audience. The token is verified with the verifier
+// before it is exchanged or looked up in the cache.
+//
+// Example:
+//
+//	client := &http.Client{Transport: NewTransport(nil, exchanger.Source(authProvider, "invoice-service"))}
+func (e *TokenExchanger) Source(verifier Verifier, audience string) TokenSource {
+	return &exchangeSource{exchanger: e, verifier: verifier, audience: audience}
+}
+
+// skew returns how long before expiry an exchanged token is refreshed.
+func (e *TokenExchanger) skew() time.Duration {
+	if e.config.TokenRefreshSkew > 0 {
+		return e.config.TokenRefreshSkew
+	}
+	return 30 * time.Second
+}
+
+var _ TokenSource = (*exchangeSource)(nil)
+
+// exchangeSource exchanges the caller's token from the context for a fixed audience.
+type exchangeSource struct {
+	exchanger *TokenExchanger
+	verifier  Verifier
+	audience  string
+}
+
+// Token implements the TokenSource interface.
+func (s *exchangeSource) Token(ctx context.Context) (*Token, error) {
+	token, err := s.inbound(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.exchanger.Exchange(ctx, token, s.audience)
+}
+
+// Refresh implements the TokenSource interface.
+func (s *exchangeSource) Refresh(ctx context.Context) (*Token, error) {
+	token, err := s.inbound(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := newExchangeKey(token, s.audience); err == nil {
+		s.exchanger.invalidate(key)
+	}
+
+	return s.exchanger.Exchange(ctx, token, s.audience)
+}
+
+// inbound returns the verified caller's token from the context.
+func (s *exchangeSource) inbound(ctx context.Context) (*jwt.Token, error) {
+	tokenString, ok := ctx.Value(provider.AccessTokenKey).(string)
+	if !ok || tokenString == "" {
+		return nil, ErrNoToken
+	}
+
+	return s.verifier.VerifyToken(ctx, tokenString)
+}
@@ -0,0 +1,180 @@
+package keyclient
+
+import (
+	"context"
+	"fmt"
+	keyimpl "github.com/YATAHAKI/KeycloakAuth/impl"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// unverifiedVerifier parses tokens without checking signatures, standing in for keyimpl.Provider.
+type unverifiedVerifier struct{}
+
+func (unverifiedVerifier) VerifyToken(_ context.Context, tokenString string) (*jwt.Token, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &jwt.RegisteredClaims{})
+	return token, err
+}
+
+func subjectToken(t *testing.T, subject string) string {
+	return issuedSubjectToken(t, "", subject)
+}
+
+func issuedSubjectToken(t *testing.T, issuer, subject string) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Issuer: issuer, Subject: subject}).
+		SignedString([]byte("secret"))
+	require.NoError(t, err)
+	return token
+}
+
+func TestTokenExchanger_Exchange(t *testing.T) {
+	server := newTokenServer(t)
+	exchanger, err := NewTokenExchanger(&keyimpl.Config{
+		TokenURI:     server.URL + "/realms/test/protocol/openid-connect/token",
+		ClientID:     "gateway",
+		ClientSecret: "s3cret",
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	alice, err := unverifiedVerifier{}.VerifyToken(ctx, subjectToken(t, "alice"))
+	require.NoError(t, err)
+	bob, err := unverifiedVerifier{}.VerifyToken(ctx, subjectToken(t, "bob"))
+	require.NoError(t, err)
+
+	token, err := exchanger.Exchange(ctx, alice, "invoice-service")
+	require.NoError(t, err)
+	assert.Equal(t, "invoice-service-1", token.AccessToken)
+
+	token, err = exchanger.Exchange(ctx, alice, "invoice-service")
+	require.NoError(t, err)
+	assert.Equal(t, "invoice-service-1", token.AccessToken, "cached per subject and audience")
+
+	token, err = exchanger.Exchange(ctx, alice, "payment-service")
+	require.NoError(t, err)
+	assert.Equal(t, "payment-service-2", token.AccessToken)
+
+	token, err = exchanger.Exchange(ctx, bob, "invoice-service")
+	require.NoError(t, err)
+	assert.Equal(t, "invoice-service-3", token.AccessToken)
+
+	exchanger.Invalidate("alice", "invoice-service")
+	token, err = exchanger.Exchange(ctx, alice, "invoice-service")
+	require.NoError(t, err)
+	assert.Equal(t, "invoice-service-4", token.AccessToken)
+}
+
+func TestTokenExchanger_Exchange_Realms(t *testing.T) {
+	server := newTokenServer(t)
+	exchanger, err := NewTokenExchanger(&keyimpl.Config{
+		TokenURI:     server.URL + "/realms/test/protocol/openid-connect/token",
+		ClientID:     "gateway",
+		ClientSecret: "s3cret",
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i, issuer := range []string{"https://sso.example.com/realms/acme", "https://sso.example.com/realms/globex"} {
+		token, err := unverifiedVerifier{}.VerifyToken(ctx, issuedSubjectToken(t, issuer, "alice"))
+		require.NoError(t, err)
+
+		exchanged, err := exchanger.Exchange(ctx, token, "invoice-service")
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("invoice-service-%d", i+1), exchanged.AccessToken, "cached per issuer")
+	}
+}
+
+func TestTokenExchanger_Exchange_Eviction(t *testing.T) {
+	server := newTokenServer(t)
+	exchanger, err := NewTokenExchanger(&keyimpl.Config{
+		TokenURI:     server.URL + "/realms/test/protocol/openid-connect/token",
+		ClientID:     "gateway",
+		ClientSecret: "s3cret",
+	})
+	require.NoError(t, err)
+	exchanger.maxSize = 2
+
+	ctx := context.Background()
+	exchange := func(subject string) string {
+		token, err := unverifiedVerifier{}.VerifyToken(ctx, subjectToken(t, subject))
+		require.NoError(t, err)
+		exchanged, err := exchanger.Exchange(ctx, token, "invoice-service")
+		require.NoError(t, err)
+		return exchanged.AccessToken
+	}
+
+	assert.Equal(t, "invoice-service-1", exchange("alice"))
+	assert.Equal(t, "invoice-service-2", exchange("bob"))
+	assert.Equal(t, "invoice-service-1", exchange("alice"), "alice becomes the most recently used")
+	assert.Equal(t, "invoice-service-3", exchange("carol"))
+	assert.Len(t, exchanger.cache, 2)
+
+	assert.Equal(t, "invoice-service-1", exchange("alice"))
+	assert.Equal(t, "invoice-service-4", exchange("bob"), "least recently used token evicted")
+}
+
+func TestTokenExchanger_Exchange_SingleFlight(t *testing.T) {
+	server := newTokenServer(t)
+	server.delay = 100 * time.Millisecond
+	exchanger, err := NewTokenExchanger(&keyimpl.Config{
+		TokenURI:     server.URL + "/realms/test/protocol/openid-connect/token",
+		ClientID:     "gateway",
+		ClientSecret: "s3cret",
+	})
+	require.NoError(t, err)
+
+	token, err := unverifiedVerifier{}.VerifyToken(context.Background(), subjectToken(t, "alice"))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 20)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exchanged, err := exchanger.Exchange(context.Background(), token, "invoice-service")
+			if assert.NoError(t, err) {
+				tokens[i] = exchanged.AccessToken
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), server.requests.Load())
+	for _, token := range tokens {
+		assert.Equal(t, "invoice-service-1", token)
+	}
+}
+
+func TestTokenExchanger_Source(t *testing.T) {
+	server := newTokenServer(t)
+	exchanger, err := NewTokenExchanger(&keyimpl.Config{
+		TokenURI:     server.URL + "/realms/test/protocol/openid-connect/token",
+		ClientID:     "gateway",
+		ClientSecret: "s3cret",
+	})
+	require.NoError(t, err)
+
+	backend := newProtectedServer(t, "invoice-service-2")
+	client := &http.Client{Transport: NewTransport(nil, exchanger.Source(unverifiedVerifier{}, "invoice-service"))}
+
+	ctx := context.WithValue(context.Background(), provider.AccessTokenKey, subjectToken(t, "alice"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend.URL, nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "rejected exchanged token is refreshed once")
+
+	req, err = http.NewRequestWithContext(context.Background(), http.MethodGet, backend.URL, nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.ErrorIs(t, err, ErrNoToken)
+}
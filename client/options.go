@@ -0,0 +1,69 @@
+package keyclient
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Option configures optional settings of the token sources.
+type Option func(*options)
+
+// options contains the optional settings shared by the token sources.
+type options struct {
+	// HTTP client used to call the token endpoint
+	httpClient *http.Client
+
+	// Propagate the inbound access token from the context instead of using the token source
+	passThrough bool
+
+	// Allow gRPC credentials over connections without transport security
+	allowInsecure bool
+
+	// Logger
+	logger *slog.Logger
+}
+
+// defaultOptions returns the options with the given settings applied over the defaults.
+func defaultOptions(opts []Option) *options {
+	o := &options{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		logger:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithHTTPClient sets the HTTP client used to call the token endpoint.
+// By default, a client with a 10 seconds timeout is used.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithPassThrough makes outbound integrations propagate the caller's access token stored in the context
+// under provider.AccessTokenKey. The token source is only used when the context has no token.
+func WithPassThrough() Option {
+	return func(o *options) {
+		o.passThrough = true
+	}
+}
+
+// WithInsecure allows gRPC credentials to be sent over connections without transport security.
+// Intended for local development only.
+func WithInsecure() Option {
+	return func(o *options) {
+		o.allowInsecure = true
+	}
+}
+
+// WithLogger sets the logger of the token sources. By default, text logs are written to stdout.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
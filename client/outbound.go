@@ -0,0 +1,49 @@
+package keyclient
+
+import (
+	"context"
+	"errors"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+)
+
+// ErrNoToken represents the error that occurs when there is neither a propagated token nor a token source.
+var ErrNoToken = errors.New("no access token available")
+
+// outbound resolves the access token attached to outbound calls.
+type outbound struct {
+	// Token source, may be nil in pass-through mode
+	source TokenSource
+
+	// Options
+	opts *options
+}
+
+// token returns the access token for the call and whether it can be refreshed through the token source.
+func (o *outbound) token(ctx context.Context) (string, bool, error) {
+	if o.opts.passThrough {
+		if token, ok := ctx.Value(provider.AccessTokenKey).(string); ok && token != "" {
+			return token, false, nil
+		}
+	}
+
+	if o.source == nil {
+		return "", false, ErrNoToken
+	}
+
+	token, err := o.source.Token(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	return token.AccessToken, true, nil
+}
+
+// refresh forces the token source to obtain a new token after the previous one was rejected.
+func (o *outbound) refresh(ctx context.Context) (string, error) {
+	token, err := o.source.Refresh(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
@@ -0,0 +1,67 @@
+// Package keyclient provides outbound integrations that obtain Keycloak tokens and attach them to requests.
+package keyclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Token represents an access token obtained from the token endpoint.
+type Token struct {
+	// AccessToken is the token attached to outbound requests.
+	AccessToken string `json:"access_token"`
+
+	// TokenType is the type of the token, usually "Bearer".
+	TokenType string `json:"token_type"`
+
+	// Scope is the space-separated list of scopes granted to the token.
+	Scope string `json:"scope,omitempty"`
+
+	// ExpiresAt is the time the token expires.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// IssuedAt is the time the token was requested.
+	IssuedAt time.Time `json:"issued_at,omitempty"`
+}
+
+// Valid reports whether the token is present and isn't due for refresh.
+func (t *Token) Valid(skew time.Duration) bool {
+	return t != nil && t.AccessToken != "" && t.refreshIn(skew) > 0
+}
+
+// refreshIn returns how long until the token is due for refresh, skew before it expires. The skew is capped
+// at half of the token lifetime, so tokens living shorter than the skew are still reused.
+func (t *Token) refreshIn(skew time.Duration) time.Duration {
+	if !t.IssuedAt.IsZero() {
+		skew = min(skew, t.ExpiresAt.Sub(t.IssuedAt)/2)
+	}
+	return time.Until(t.ExpiresAt.Add(-skew))
+}
+
+// TokenSource supplies access tokens for outbound calls.
+type TokenSource interface {
+	// Token returns a valid token, using a cached one when possible.
+	Token(ctx context.Context) (*Token, error)
+
+	// Refresh discards the cached token and obtains a new one,
+	// e.g. after the token was rejected by the called service.
+	Refresh(ctx context.Context) (*Token, error)
+}
+
+// TokenError represents an error response of the token endpoint (RFC 6749, section 5.2).
+type TokenError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Code is the OAuth2 error code, e.g. "invalid_client".
+	Code string `json:"error"`
+
+	// Description is the human-readable error description.
+	Description string `json:"error_description"`
+}
+
+// Error implements the error interface.
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("token endpoint returned status %d: %s %s", e.StatusCode, e.Code, e.Description)
+}
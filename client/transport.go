@@ -0,0 +1,88 @@
+package keyclient
+
+import (
+	"io"
+	"net/http"
+)
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// Transport is an http.RoundTripper that adds "Authorization: Bearer" to outgoing requests.
+// When the server answers 401, the request is retried once with a refreshed token,
+// provided its body can be replayed.
+type Transport struct {
+	outbound
+
+	// Base is the underlying round tripper. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+}
+
+// NewTransport creates a round tripper backed by the token source.
+// The source may be nil when WithPassThrough is used and every request carries the caller's token.
+//
+// Example:
+//
+//	client := &http.Client{Transport: NewTransport(http.DefaultTransport, source)}
+func NewTransport(base http.RoundTripper, source TokenSource, opts ...Option) *Transport {
+	return &Transport{
+		outbound: outbound{source: source, opts: defaultOptions(opts)},
+		Base:     base,
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	token, refreshable, err := t.token(ctx)
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	resp, err := t.base().RoundTrip(authorize(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !refreshable {
+		return resp, err
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	if token, err = t.refresh(ctx); err != nil {
+		return resp, nil
+	}
+
+	retry := authorize(req, token)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	return t.base().RoundTrip(retry)
+}
+
+// base returns the underlying round tripper.
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// authorize returns a copy of the request with the bearer token set.
+func authorize(req *http.Request, token string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	return clone
+}
+
+// closeBody closes the request body, as required from a RoundTripper even on errors.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
@@ -0,0 +1,147 @@
+package keyclient
+
+import (
+	"context"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticSource is a TokenSource issuing "token-N", where N grows with every refresh.
+type staticSource struct {
+	refreshes int
+}
+
+func (s *staticSource) Token(context.Context) (*Token, error) {
+	return &Token{AccessToken: fmt.Sprintf("token-%d", s.refreshes), ExpiresAt: time.Now().Add(time.Hour)}, nil
+}
+
+func (s *staticSource) Refresh(ctx context.Context) (*Token, error) {
+	s.refreshes++
+	return s.Token(ctx)
+}
+
+// newProtectedServer starts a server accepting only the given bearer token and echoing the request body.
+func newProtectedServer(t *testing.T, accepted string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+accepted {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.Copy(w, r.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransport_RetryWithRefreshedToken(t *testing.T) {
+	server := newProtectedServer(t, "token-1")
+	source := &staticSource{}
+	client := &http.Client{Transport: NewTransport(nil, source)}
+
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "payload", string(body))
+	assert.Equal(t, 1, source.refreshes)
+}
+
+func TestTransport_RetryOnlyOnce(t *testing.T) {
+	server := newProtectedServer(t, "token-5")
+	source := &staticSource{}
+	client := &http.Client{Transport: NewTransport(nil, source)}
+
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, 1, source.refreshes)
+}
+
+func TestTransport_PassThrough(t *testing.T) {
+	server := newProtectedServer(t, "inbound")
+	source := &staticSource{}
+	client := &http.Client{Transport: NewTransport(nil, source, WithPassThrough())}
+
+	ctx := context.WithValue(context.Background(), provider.AccessTokenKey, "inbound")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, err = http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "falls back to the token source")
+}
+
+func TestTransport_PassThroughWithoutSource(t *testing.T) {
+	client := &http.Client{Transport: NewTransport(nil, nil, WithPassThrough())}
+
+	_, err := client.Get("http://127.0.0.1:1")
+	require.ErrorIs(t, err, ErrNoToken)
+}
+
+func TestPerRPCCredentials(t *testing.T) {
+	source := &staticSource{}
+	creds := NewPerRPCCredentials(source)
+	assert.True(t, creds.RequireTransportSecurity())
+	assert.False(t, NewPerRPCCredentials(source, WithInsecure()).RequireTransportSecurity())
+
+	metadata, err := creds.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer token-0"}, metadata)
+
+	ctx := context.WithValue(context.Background(), provider.AccessTokenKey, "inbound")
+	metadata, err = NewPerRPCCredentials(source, WithPassThrough()).GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"authorization": "Bearer inbound"}, metadata)
+}
+
+func TestPerRPCCredentials_UnaryClientInterceptor(t *testing.T) {
+	source := &staticSource{}
+	creds := NewPerRPCCredentials(source)
+	interceptor := creds.UnaryClientInterceptor()
+
+	var calls []string
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		metadata, err := creds.GetRequestMetadata(ctx)
+		require.NoError(t, err)
+		calls = append(calls, metadata["authorization"])
+		if metadata["authorization"] != "Bearer token-1" {
+			return status.Error(codes.Unauthenticated, "token expired")
+		}
+		return nil
+	}
+
+	err := interceptor(context.Background(), "/package.service/Method", nil, nil, nil, invoker)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer token-0", "Bearer token-1"}, calls)
+
+	calls = nil
+	source.refreshes = 5
+	err = interceptor(context.Background(), "/package.service/Method", nil, nil, nil, invoker)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Len(t, calls, 2)
+}
@@ -0,0 +1,37 @@
+package examples
+
+import (
+	"errors"
+	"fmt"
+	keyimpl "github.com/YATAHAKI/KeycloakAuth/impl"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"strings"
+)
+
+// bearerChallenge builds the WWW-Authenticate header value for a failed authorization (RFC 6750, RFC 9449, RFC 9470).
+// A nil error produces a bare challenge used when no token was presented.
+func bearerChallenge(err error) string {
+	var stepUp *models.StepUpError
+	var scope *models.ScopeError
+	switch {
+	case err == nil:
+		return "Bearer"
+	case errors.As(err, &stepUp):
+		params := []string{
+			`error="insufficient_user_authentication"`,
+			`error_description="A different authentication level is required"`,
+		}
+		if stepUp.ACR != "" {
+			params = append(params, fmt.Sprintf("acr_values=%q", stepUp.ACR))
+		}
+		return "Bearer " + strings.Join(params, ", ")
+	case errors.Is(err, models.ErrInvalidDPoPProof):
+		return fmt.Sprintf(`DPoP error="invalid_dpop_proof", algs=%q`, strings.Join(keyimpl.DPoPSigningAlgorithms, " "))
+	case errors.As(err, &scope):
+		return fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scope.Scopes, " "))
+	case errors.Is(err, models.ErrInvalidToken):
+		return `Bearer error="invalid_token"`
+	default:
+		return "Bearer"
+	}
+}
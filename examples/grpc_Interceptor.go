@@ -2,17 +2,22 @@ package examples
 
 import (
 	"context"
+	"errors"
+	"github.com/YATAHAKI/KeycloakAuth/extract"
 	"github.com/YATAHAKI/KeycloakAuth/models"
 	"github.com/YATAHAKI/KeycloakAuth/provider"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"log/slog"
-	"strings"
 )
 
-func NewAuthInterceptor(auth provider.AuthProvider, logger *slog.Logger) grpc.UnaryServerInterceptor {
+// NewAuthInterceptor authorizes the calls to secure methods with the token found by the extractors,
+// by default the "authorization" metadata key with the Bearer or DPoP scheme.
+func NewAuthInterceptor(auth provider.AuthProvider, logger *slog.Logger, extractors ...keyextract.Extractor) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		if !auth.IsSecureEndpoint(models.SecureEndpoint{
 			Path: info.FullMethod,
@@ -27,34 +32,54 @@ func NewAuthInterceptor(auth provider.AuthProvider, logger *slog.Logger) grpc.Un
 			return nil, status.Error(codes.Unauthenticated, "Failed to get metadata")
 		}
 
-		authHeader, ok := md["authorization"]
-		if !ok || len(authHeader) == 0 {
-			logger.Error("Failed to get authorization header", slog.String("method", info.FullMethod))
-			return nil, status.Error(codes.Unauthenticated, "Failed to get authorization header")
+		request := keyextract.GRPCRequest(md)
+		token, err := keyextract.Extract(request, extractors...)
+		if errors.Is(err, keyextract.ErrNoToken) {
+			logger.Error("Failed to get access token", slog.String("method", info.FullMethod))
+			return nil, status.Error(codes.Unauthenticated, "Failed to get access token")
+		}
+		if err != nil {
+			logger.Error("Incorrect authorization token", slog.String("method", info.FullMethod), slog.String("error", err.Error()))
+			return nil, authStatus(codes.Unauthenticated, "Incorrect authorization token", err)
 		}
 
-		token := strings.TrimPrefix(authHeader[0], "Bearer ")
-		if token == authHeader[0] {
-			logger.Error("Incorrect authorization token", slog.String("method", info.FullMethod))
-			return nil, status.Error(codes.Unauthenticated, "Incorrect authorization token")
+		requestInfo := models.RequestInfo{
+			Scheme:  token.Scheme,
+			Path:    info.FullMethod,
+			Message: req,
+			Headers: request.Header,
 		}
+		if p, ok := peer.FromContext(ctx); ok {
+			if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+				requestInfo.ClientCertificate = tlsInfo.State.PeerCertificates[0]
+			}
+		}
+		ctx = context.WithValue(ctx, provider.RequestInfoKey, requestInfo)
 
-		user, err := auth.AuthorizeGRPC(ctx, info.FullMethod, token)
+		user, err := auth.AuthorizeGRPC(ctx, info.FullMethod, token.Value)
+		if errors.Is(err, models.ErrInsufficientUserAuthentication) {
+			logger.Info("Step-up authentication required", "method", info.FullMethod, "error", err)
+			if headerErr := grpc.SetHeader(ctx, metadata.Pairs("www-authenticate", bearerChallenge(err))); headerErr != nil {
+				logger.Error("Failed to set challenge header", "method", info.FullMethod, "error", headerErr)
+			}
+			return nil, authStatus(codes.Unauthenticated, "Step-up authentication required", err)
+		}
 		if err != nil {
-			logger.Error("Authorization failed", "method", info.FullMethod, "error", err)
-			return nil, status.Error(codes.PermissionDenied, "Authorization failed")
+			logger.Info("Authorization failed", "method", info.FullMethod, "error", err)
+			return nil, authStatus(authCode(err), "Authorization failed", err)
 		}
 
-		logger.Info("Authorization succeeded", "method", info.FullMethod, "user", user.Username)
+		logger.Info("Authorization succeeded", "method", info.FullMethod, "client", user.ClientID)
 
 		ctx = context.WithValue(ctx, provider.UserDetailsKey, user)
+		ctx = context.WithValue(ctx, provider.AccessTokenKey, token.Value)
 		resp, err := handler(ctx, req)
 		if err != nil {
 			logger.Error("Failed to call handler", "method", info.FullMethod, "error", err)
 			return nil, err
 		}
 
-		logger.Info("Call success", "method", info.FullMethod, "user", user.Username)
+		logger.Info("Call success", "method", info.FullMethod, "client", user.ClientID)
 		return resp, nil
 	}
 }
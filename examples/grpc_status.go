@@ -0,0 +1,130 @@
+package examples
+
+import (
+	"errors"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+)
+
+// errorDomain is the domain of the google.rpc.ErrorInfo details attached to failed calls.
+const errorDomain = "keycloak-auth"
+
+// authStatus builds the status of a failed authorization. The google.rpc.ErrorInfo details carry the reason
+// of the failure in upper snake case (e.g. MISSING_ROLE) and what the endpoint requires, and step-up and
+// proof-of-possession failures add google.rpc.PreconditionFailure details.
+func authStatus(code codes.Code, message string, err error) error {
+	st := status.New(code, message)
+
+	info := &errdetails.ErrorInfo{
+		Reason:   strings.ToUpper(string(models.ReasonOf(err))),
+		Domain:   errorDomain,
+		Metadata: errorMetadata(err),
+	}
+	detailed, detailsErr := st.WithDetails(info)
+	if violations := preconditionViolations(err); detailsErr == nil && len(violations) > 0 {
+		detailed, detailsErr = detailed.WithDetails(&errdetails.PreconditionFailure{Violations: violations})
+	}
+	if detailsErr != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
+// authCode returns the status code of the authorization error: Unauthenticated when the token or its proof
+// is rejected or a stronger authentication is required, PermissionDenied otherwise.
+func authCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, models.ErrInvalidToken),
+		errors.Is(err, models.ErrInvalidDPoPProof),
+		errors.Is(err, models.ErrInsufficientUserAuthentication):
+		return codes.Unauthenticated
+	default:
+		return codes.PermissionDenied
+	}
+}
+
+// errorMetadata returns the requirements of the endpoint the token doesn't satisfy, with space-separated values.
+func errorMetadata(err error) map[string]string {
+	metadata := make(map[string]string)
+
+	var authErr *models.AuthError
+	if errors.As(err, &authErr) && len(authErr.Required) > 0 {
+		required := strings.Join(authErr.Required, " ")
+		switch authErr.Reason {
+		case models.ReasonClientNotAllowed:
+			metadata["allowed_clients"] = required
+		case models.ReasonMissingRole:
+			metadata["required_roles"] = required
+		case models.ReasonMissingGroup:
+			metadata["required_groups"] = required
+		case models.ReasonMissingPermission:
+			metadata["required_permissions"] = required
+		case models.ReasonInsufficientScope:
+			metadata["required_scopes"] = required
+		}
+	}
+
+	var scope *models.ScopeError
+	if errors.As(err, &scope) && len(scope.Scopes) > 0 {
+		metadata["required_scopes"] = strings.Join(scope.Scopes, " ")
+	}
+
+	var stepUp *models.StepUpError
+	if errors.As(err, &stepUp) {
+		if stepUp.ACR != "" {
+			metadata["acr_values"] = stepUp.ACR
+		}
+		if len(stepUp.AMR) > 0 {
+			metadata["amr"] = strings.Join(stepUp.AMR, " ")
+		}
+	}
+
+	return metadata
+}
+
+// preconditionViolations returns the violations the client can fix by authenticating again or by presenting
+// the proof of possession the token is bound to.
+func preconditionViolations(err error) []*errdetails.PreconditionFailure_Violation {
+	var violations []*errdetails.PreconditionFailure_Violation
+
+	var stepUp *models.StepUpError
+	if errors.As(err, &stepUp) {
+		if stepUp.ACR != "" {
+			violations = append(violations, &errdetails.PreconditionFailure_Violation{
+				Type:        "ACR",
+				Subject:     "acr",
+				Description: fmt.Sprintf("Authentication context class %q is required", stepUp.ACR),
+			})
+		}
+		if len(stepUp.AMR) > 0 {
+			violations = append(violations, &errdetails.PreconditionFailure_Violation{
+				Type:        "AMR",
+				Subject:     "amr",
+				Description: fmt.Sprintf("Authentication methods [%s] are required", strings.Join(stepUp.AMR, " ")),
+			})
+		}
+		return violations
+	}
+
+	switch models.ReasonOf(err) {
+	case models.ReasonInvalidDPoPProof:
+		violations = append(violations, &errdetails.PreconditionFailure_Violation{
+			Type:        "DPOP",
+			Subject:     "dpop",
+			Description: "A valid DPoP proof for the token is required",
+		})
+	case models.ReasonInvalidBinding:
+		violations = append(violations, &errdetails.PreconditionFailure_Violation{
+			Type:        "TOKEN_BINDING",
+			Subject:     "cnf",
+			Description: "The token must be presented with the key or certificate it is bound to",
+		})
+	}
+
+	return violations
+}
@@ -0,0 +1,123 @@
+package examples
+
+import (
+	"errors"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestAuthStatus(t *testing.T) {
+	test := []struct {
+		name       string
+		err        error
+		code       codes.Code
+		reason     string
+		metadata   map[string]string
+		violations []string
+	}{
+		{
+			name:     "Missing role",
+			err:      &models.AuthError{Reason: models.ReasonMissingRole, Required: []string{"admin", "auditor"}},
+			code:     codes.PermissionDenied,
+			reason:   "MISSING_ROLE",
+			metadata: map[string]string{"required_roles": "admin auditor"},
+		},
+		{
+			name: "Insufficient scope",
+			err: &models.AuthError{
+				Reason:   models.ReasonInsufficientScope,
+				Required: []string{"invoices:read"},
+				Err:      &models.ScopeError{Scopes: []string{"invoices:read"}},
+			},
+			code:     codes.PermissionDenied,
+			reason:   "INSUFFICIENT_SCOPE",
+			metadata: map[string]string{"required_scopes": "invoices:read"},
+		},
+		{
+			name: "Step-up",
+			err: &models.AuthError{
+				Reason: models.ReasonInsufficientAuthentication,
+				Err:    &models.StepUpError{ACR: "2", AMR: []string{"otp"}},
+			},
+			code:       codes.Unauthenticated,
+			reason:     "INSUFFICIENT_AUTHENTICATION",
+			metadata:   map[string]string{"acr_values": "2", "amr": "otp"},
+			violations: []string{"ACR", "AMR"},
+		},
+		{
+			name: "Invalid DPoP proof",
+			err: &models.AuthError{
+				Reason: models.ReasonInvalidDPoPProof,
+				Err:    fmt.Errorf("%w: proof was already used", models.ErrInvalidDPoPProof),
+			},
+			code:       codes.Unauthenticated,
+			reason:     "INVALID_DPOP_PROOF",
+			violations: []string{"DPOP"},
+		},
+		{
+			name: "Invalid binding",
+			err: &models.AuthError{
+				Reason: models.ReasonInvalidBinding,
+				Err:    errors.New("client certificate doesn't match the token"),
+			},
+			code:       codes.Unauthenticated,
+			reason:     "INVALID_BINDING",
+			violations: []string{"TOKEN_BINDING"},
+		},
+		{
+			name:   "Invalid token",
+			err:    &models.AuthError{Reason: models.ReasonExpired},
+			code:   codes.Unauthenticated,
+			reason: "EXPIRED",
+		},
+		{
+			name:   "Policy denial",
+			err:    &models.AuthError{Reason: models.ReasonPolicyDenied},
+			code:   codes.PermissionDenied,
+			reason: "POLICY_DENIED",
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			code := authCode(tt.err)
+			assert.Equal(t, tt.code, code)
+
+			st, ok := status.FromError(authStatus(code, "Authorization failed", tt.err))
+			require.True(t, ok)
+			assert.Equal(t, tt.code, st.Code())
+			assert.Equal(t, "Authorization failed", st.Message())
+
+			var (
+				info       *errdetails.ErrorInfo
+				violations []string
+			)
+			for _, detail := range st.Details() {
+				switch detail := detail.(type) {
+				case *errdetails.ErrorInfo:
+					info = detail
+				case *errdetails.PreconditionFailure:
+					for _, violation := range detail.GetViolations() {
+						violations = append(violations, violation.GetType())
+					}
+				}
+			}
+
+			require.NotNil(t, info)
+			assert.Equal(t, errorDomain, info.GetDomain())
+			assert.Equal(t, tt.reason, info.GetReason())
+			if tt.metadata == nil {
+				assert.Empty(t, info.GetMetadata())
+			} else {
+				assert.Equal(t, tt.metadata, info.GetMetadata())
+			}
+			assert.Equal(t, tt.violations, violations)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package examples
+
+import (
+	"context"
+	"errors"
+	"github.com/YATAHAKI/KeycloakAuth/extract"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// NewAuthMiddleware authorizes the requests to secure endpoints with the token found by the extractors,
+// by default the Authorization header with the Bearer or DPoP scheme.
+func NewAuthMiddleware(auth provider.AuthProvider, logger *slog.Logger, extractors ...keyextract.Extractor) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.IsSecureEndpoint(models.SecureEndpoint{
+				Path:   r.URL.Path,
+				Method: r.Method,
+			}) {
+				logger.Info("Endpoint not protected", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := keyextract.Extract(keyextract.HTTPRequest(r), extractors...)
+			if errors.Is(err, keyextract.ErrNoToken) {
+				logger.Error("Failed to get access token", slog.String("path", r.URL.Path))
+				w.Header().Set("WWW-Authenticate", bearerChallenge(nil))
+				http.Error(w, "Failed to get access token", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				logger.Error("Incorrect authorization token", slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+				w.Header().Set("WWW-Authenticate", bearerChallenge(models.ErrInvalidToken))
+				http.Error(w, "Incorrect authorization token", http.StatusUnauthorized)
+				return
+			}
+
+			info := models.RequestInfo{
+				Scheme:  token.Scheme,
+				Method:  r.Method,
+				Path:    r.URL.Path,
+				URL:     requestURL(r),
+				Headers: r.Header,
+			}
+			if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+				info.ClientCertificate = r.TLS.PeerCertificates[0]
+			}
+			ctx := context.WithValue(r.Context(), provider.RequestInfoKey, info)
+
+			user, err := auth.AuthorizeHTTP(ctx, r.Method, r.URL.Path, token.Value)
+			if err != nil {
+				logger.Info("Authorization failed", "path", r.URL.Path, "error", err)
+				if errors.Is(err, models.ErrInsufficientScope) {
+					w.Header().Set("WWW-Authenticate", bearerChallenge(err))
+					http.Error(w, "Insufficient scope", http.StatusForbidden)
+					return
+				}
+				if errors.Is(err, models.ErrAccessDenied) {
+					http.Error(w, "Authorization failed", http.StatusForbidden)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", bearerChallenge(err))
+				http.Error(w, "Authorization failed", http.StatusUnauthorized)
+				return
+			}
+
+			logger.Info("Authorization succeeded", "path", r.URL.Path, "client", user.ClientID)
+
+			ctx = context.WithValue(ctx, provider.UserDetailsKey, user)
+			ctx = context.WithValue(ctx, provider.AccessTokenKey, token.Value)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestURL returns the absolute URL of the request without query, as used in DPoP proofs.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return (&url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}).String()
+}
@@ -0,0 +1,185 @@
+// Package keyextract finds the access token of an incoming HTTP request or gRPC call.
+//
+// Tokens are looked up by a chain of extractors, e.g. the Authorization header, a custom header or
+// gRPC metadata key, a cookie or a query parameter. A request presenting different tokens in several places
+// is rejected as ambiguous (RFC 6750, section 2).
+package keyextract
+
+import (
+	"errors"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Errors of token extraction. ErrUnsupportedScheme and ErrAmbiguousToken match models.ErrInvalidToken.
+var (
+	ErrNoToken           = errors.New("no access token presented")
+	ErrUnsupportedScheme = fmt.Errorf("%w: unsupported authorization scheme", models.ErrInvalidToken)
+	ErrAmbiguousToken    = fmt.Errorf("%w: more than one access token presented", models.ErrInvalidToken)
+)
+
+// Authorization schemes.
+const (
+	SchemeBearer = "Bearer"
+	SchemeDPoP   = "DPoP"
+)
+
+// Token is an access token found in the request.
+type Token struct {
+	// Value is the token string.
+	Value string
+
+	// Scheme is the authorization scheme the token was presented with, "Bearer" unless
+	// the source carries the scheme.
+	Scheme string
+
+	// Source describes where the token was found, e.g. "header:Authorization".
+	Source string
+}
+
+// Request holds the parts of an HTTP request or a gRPC call tokens are extracted from.
+type Request struct {
+	// Header holds the HTTP headers or the gRPC metadata.
+	Header http.Header
+
+	// Query holds the query parameters of an HTTP request.
+	Query url.Values
+}
+
+// HTTPRequest returns the Request of the HTTP request.
+func HTTPRequest(r *http.Request) Request {
+	return Request{Header: r.Header, Query: r.URL.Query()}
+}
+
+// GRPCRequest returns the Request of the gRPC call metadata. The metadata keys are available as headers.
+func GRPCRequest(md metadata.MD) Request {
+	header := make(http.Header, len(md))
+	for key, values := range md {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	return Request{Header: header}
+}
+
+// Extractor returns the tokens presented in its source of the request, or none if the source is absent.
+type Extractor func(request Request) ([]Token, error)
+
+// DefaultExtractors returns the extractors used when none are configured: the Authorization header
+// with the Bearer and DPoP schemes.
+func DefaultExtractors() []Extractor {
+	return []Extractor{AuthorizationHeader(SchemeBearer, SchemeDPoP)}
+}
+
+// Extract runs the extractors and returns the only token presented in the request.
+// It returns ErrNoToken if no extractor found a token and ErrAmbiguousToken if different tokens were found.
+// With no extractors, DefaultExtractors are used.
+func Extract(request Request, extractors ...Extractor) (Token, error) {
+	if len(extractors) == 0 {
+		extractors = DefaultExtractors()
+	}
+
+	var found []Token
+	for _, extractor := range extractors {
+		tokens, err := extractor(request)
+		if err != nil {
+			return Token{}, err
+		}
+		found = append(found, tokens...)
+	}
+
+	if len(found) == 0 {
+		return Token{}, ErrNoToken
+	}
+	for _, token := range found[1:] {
+		if token.Value != found[0].Value || !strings.EqualFold(token.Scheme, found[0].Scheme) {
+			return Token{}, fmt.Errorf("%w: %s and %s", ErrAmbiguousToken, found[0].Source, token.Source)
+		}
+	}
+
+	return found[0], nil
+}
+
+// AuthorizationHeader extracts the token from the Authorization header (or "authorization" metadata key)
+// presented with one of the schemes, compared case-insensitively.
+func AuthorizationHeader(schemes ...string) Extractor {
+	return Header("Authorization", schemes...)
+}
+
+// Header extracts the token from the header or gRPC metadata key, e.g. "x-access-token".
+// With schemes, the value must be "<scheme> <token>" with one of the schemes, compared case-insensitively;
+// without schemes, the whole value is a bearer token.
+func Header(name string, schemes ...string) Extractor {
+	source := "header:" + http.CanonicalHeaderKey(name)
+	return func(request Request) ([]Token, error) {
+		var tokens []Token
+		for _, value := range request.Header.Values(name) {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if len(schemes) == 0 {
+				tokens = append(tokens, Token{Value: value, Scheme: SchemeBearer, Source: source})
+				continue
+			}
+
+			token, err := parseAuthorization(value, schemes)
+			if err != nil {
+				return nil, err
+			}
+			token.Source = source
+			tokens = append(tokens, token)
+		}
+		return tokens, nil
+	}
+}
+
+// Cookie extracts a bearer token from the cookie, e.g. for browsers opening WebSockets or server-sent events.
+func Cookie(name string) Extractor {
+	source := "cookie:" + name
+	return func(request Request) ([]Token, error) {
+		var tokens []Token
+		for _, cookie := range (&http.Request{Header: request.Header}).CookiesNamed(name) {
+			if cookie.Value != "" {
+				tokens = append(tokens, Token{Value: cookie.Value, Scheme: SchemeBearer, Source: source})
+			}
+		}
+		return tokens, nil
+	}
+}
+
+// Query extracts a bearer token from the query parameter, e.g. "access_token".
+// Tokens in URLs end up in access logs and browser history, so the extractor is only used when configured.
+func Query(name string) Extractor {
+	source := "query:" + name
+	return func(request Request) ([]Token, error) {
+		var tokens []Token
+		for _, value := range request.Query[name] {
+			if value != "" {
+				tokens = append(tokens, Token{Value: value, Scheme: SchemeBearer, Source: source})
+			}
+		}
+		return tokens, nil
+	}
+}
+
+// parseAuthorization splits the "<scheme> <token>" value and checks the scheme is one of the schemes.
+func parseAuthorization(value string, schemes []string) (Token, error) {
+	scheme, token, ok := strings.Cut(value, " ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		return Token{}, fmt.Errorf("%w: expected \"<scheme> <token>\"", models.ErrInvalidToken)
+	}
+
+	for _, allowed := range schemes {
+		if strings.EqualFold(scheme, allowed) {
+			return Token{Value: token, Scheme: allowed}, nil
+		}
+	}
+
+	return Token{}, fmt.Errorf("%w %q", ErrUnsupportedScheme, scheme)
+}
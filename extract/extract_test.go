@@ -0,0 +1,127 @@
+package keyextract
+
+import (
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtract_HTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(r *http.Request)
+		extractors []Extractor
+		expected   Token
+		err        error
+	}{
+		{
+			name:     "Default bearer header",
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "Bearer abc") },
+			expected: Token{Value: "abc", Scheme: SchemeBearer, Source: "header:Authorization"},
+		},
+		{
+			name:     "Case-insensitive scheme",
+			setup:    func(r *http.Request) { r.Header.Set("Authorization", "dpop abc") },
+			expected: Token{Value: "abc", Scheme: SchemeDPoP, Source: "header:Authorization"},
+		},
+		{
+			name:  "Unsupported scheme",
+			setup: func(r *http.Request) { r.Header.Set("Authorization", "Basic abc") },
+			err:   ErrUnsupportedScheme,
+		},
+		{
+			name:  "Missing token after scheme",
+			setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") },
+			err:   models.ErrInvalidToken,
+		},
+		{
+			name:  "No token",
+			setup: func(r *http.Request) {},
+			err:   ErrNoToken,
+		},
+		{
+			name:       "Custom header without scheme",
+			setup:      func(r *http.Request) { r.Header.Set("X-Access-Token", "abc") },
+			extractors: []Extractor{AuthorizationHeader(SchemeBearer), Header("x-access-token")},
+			expected:   Token{Value: "abc", Scheme: SchemeBearer, Source: "header:X-Access-Token"},
+		},
+		{
+			name:       "Cookie",
+			setup:      func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "access_token", Value: "abc"}) },
+			extractors: []Extractor{AuthorizationHeader(SchemeBearer), Cookie("access_token")},
+			expected:   Token{Value: "abc", Scheme: SchemeBearer, Source: "cookie:access_token"},
+		},
+		{
+			name:  "Query is opt-in",
+			setup: func(r *http.Request) { r.URL.RawQuery = "access_token=abc" },
+			err:   ErrNoToken,
+		},
+		{
+			name:       "Query",
+			setup:      func(r *http.Request) { r.URL.RawQuery = "access_token=abc" },
+			extractors: []Extractor{Query("access_token")},
+			expected:   Token{Value: "abc", Scheme: SchemeBearer, Source: "query:access_token"},
+		},
+		{
+			name: "Same token in several sources",
+			setup: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer abc")
+				r.AddCookie(&http.Cookie{Name: "access_token", Value: "abc"})
+			},
+			extractors: []Extractor{AuthorizationHeader(SchemeBearer), Cookie("access_token")},
+			expected:   Token{Value: "abc", Scheme: SchemeBearer, Source: "header:Authorization"},
+		},
+		{
+			name: "Different tokens in several sources",
+			setup: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer abc")
+				r.URL.RawQuery = "access_token=def"
+			},
+			extractors: []Extractor{AuthorizationHeader(SchemeBearer), Query("access_token")},
+			err:        ErrAmbiguousToken,
+		},
+		{
+			name: "Different tokens in one header",
+			setup: func(r *http.Request) {
+				r.Header.Add("Authorization", "Bearer abc")
+				r.Header.Add("Authorization", "Bearer def")
+			},
+			err: ErrAmbiguousToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/events", nil)
+			tt.setup(r)
+
+			token, err := Extract(HTTPRequest(r), tt.extractors...)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, token)
+		})
+	}
+}
+
+func TestExtract_GRPC(t *testing.T) {
+	md := metadata.Pairs("x-access-token", "abc")
+
+	token, err := Extract(GRPCRequest(md), AuthorizationHeader(SchemeBearer), Header("x-access-token"))
+	require.NoError(t, err)
+	assert.Equal(t, Token{Value: "abc", Scheme: SchemeBearer, Source: "header:X-Access-Token"}, token)
+
+	token, err = Extract(GRPCRequest(metadata.Pairs("authorization", "BEARER abc")))
+	require.NoError(t, err)
+	assert.Equal(t, "abc", token.Value)
+	assert.Equal(t, SchemeBearer, token.Scheme)
+
+	_, err = Extract(GRPCRequest(md))
+	assert.ErrorIs(t, err, ErrNoToken)
+}
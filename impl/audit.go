@@ -0,0 +1,39 @@
+package keyimpl
+
+import (
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/audit"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"log/slog"
+	"time"
+)
+
+// logDecision writes the authorization decision to the decision log, if any.
+func (p *Provider) logDecision(ctx context.Context, a authorization) {
+	if p.decisionLog == nil {
+		return
+	}
+
+	event := keyaudit.Event{
+		Time:          time.Now(),
+		Subject:       a.user.UserID,
+		ClientID:      a.user.ClientID,
+		Realm:         a.user.Realm,
+		Transport:     a.transport,
+		Endpoint:      a.endpoint,
+		RequiredRoles: a.rule.Roles,
+		PresentRoles:  a.user.Roles,
+		Decision:      keyaudit.DecisionAllowed,
+	}
+	if a.claims != nil {
+		event.TokenID = a.claims.ID
+	}
+	if a.err != nil {
+		event.Decision = keyaudit.DecisionDenied
+		event.Reason = string(models.ReasonOf(a.err))
+	}
+
+	if err := p.decisionLog.Write(ctx, event); err != nil {
+		p.logger.Error("Failed to write decision log", slog.String("err", err.Error()))
+	}
+}
@@ -0,0 +1,58 @@
+package keyimpl
+
+import (
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/audit"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestProvider_DecisionLog(t *testing.T) {
+	issuer := newTestIssuer(t)
+	var events []keyaudit.Event
+	sink := keyaudit.SinkFunc(func(_ context.Context, event keyaudit.Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	config := issuer.config()
+	config.PrincipalClaim = "sub"
+	config.SubjectPolicy = "uuid4"
+	p := NewHTTPProvider(config, newTestRedis(t), WithDecisionLog(sink))
+	require.NoError(t, p.RegisterEndpoint(
+		models.EndpointInfo{Method: http.MethodGet, Path: "/api/reports", Roles: []string{"user"}},
+		models.EndpointInfo{Method: http.MethodDelete, Path: "/api/reports", Roles: []string{"admin"}},
+	))
+
+	claims := userClaims()
+	claims["jti"] = "4f6a1c2e"
+	token := issuer.sign(t, claims)
+
+	_, err := p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports", token)
+	require.NoError(t, err)
+	_, err = p.AuthorizeHTTP(context.Background(), http.MethodDelete, "/api/reports", token)
+	require.ErrorIs(t, err, models.ErrAccessDenied)
+	_, err = p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports", "garbage")
+	require.ErrorIs(t, err, models.ErrInvalidToken)
+
+	require.Len(t, events, 3)
+	for _, event := range events {
+		assert.False(t, event.Time.IsZero())
+	}
+
+	assert.Equal(t, "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60", events[0].Subject)
+	assert.Equal(t, "4f6a1c2e", events[0].TokenID)
+	assert.Equal(t, keyaudit.DecisionAllowed, events[0].Decision)
+
+	assert.Equal(t, "DELETE /api/reports", events[1].Endpoint)
+	assert.Equal(t, []string{"admin"}, events[1].RequiredRoles)
+	assert.Equal(t, []string{"user"}, events[1].PresentRoles)
+	assert.Equal(t, keyaudit.DecisionDenied, events[1].Decision)
+	assert.Equal(t, "missing_role", events[1].Reason)
+
+	assert.Empty(t, events[2].Subject)
+	assert.Equal(t, "malformed", events[2].Reason)
+}
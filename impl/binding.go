@@ -0,0 +1,65 @@
+package keyimpl
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"strings"
+)
+
+// VerifyBinding checks that a sender-constrained token is presented by its holder.
+// A DPoP-bound token (cnf.jkt) must be presented with the DPoP scheme and a valid proof,
+// and the DPoP scheme is only accepted for DPoP-bound tokens.
+// A certificate-bound token (cnf.x5t#S256) must be presented with the matching client certificate, and
+// endpoints with RequireCertificateBinding only accept certificate-bound tokens.
+// The request is described by models.RequestInfo stored in the context under provider.RequestInfoKey.
+func (p *Provider) VerifyBinding(ctx context.Context, claims *models.Claims, tokenString string, rule models.EndpointInfo) error {
+	info, _ := ctx.Value(provider.RequestInfoKey).(models.RequestInfo)
+
+	if err := p.VerifyCertificateBinding(claims, info.ClientCertificate, rule.RequireCertificateBinding); err != nil {
+		return err
+	}
+
+	isDPoP := strings.EqualFold(info.Scheme, "DPoP")
+
+	switch {
+	case claims.Cnf.JKT == "" && isDPoP:
+		return fmt.Errorf("%w: token isn't DPoP-bound", models.ErrInvalidDPoPProof)
+	case claims.Cnf.JKT == "":
+		return nil
+	case !isDPoP:
+		return fmt.Errorf("%w: DPoP-bound token presented without DPoP", models.ErrInvalidToken)
+	}
+
+	proofs := info.Headers.Values("DPoP")
+	if len(proofs) != 1 {
+		return fmt.Errorf("%w: exactly one DPoP header is required", models.ErrInvalidDPoPProof)
+	}
+
+	return p.VerifyDPoP(ctx, proofs[0], info.Method, info.URL, tokenString, claims.Cnf.JKT)
+}
+
+// VerifyCertificateBinding checks the token's cnf.x5t#S256 against the client certificate (RFC 8705).
+// A certificate-bound token is always rejected unless the matching certificate is presented,
+// and if required, the token must be certificate-bound.
+func (p *Provider) VerifyCertificateBinding(claims *models.Claims, certificate *x509.Certificate, required bool) error {
+	switch {
+	case required && claims.Cnf.X5tS256 == "":
+		return fmt.Errorf("%w: token isn't certificate-bound", models.ErrInvalidToken)
+	case claims.Cnf.X5tS256 == "":
+		return nil
+	case certificate == nil:
+		return fmt.Errorf("%w: no client certificate presented", models.ErrInvalidToken)
+	}
+
+	sum := sha256.Sum256(certificate.Raw)
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != claims.Cnf.X5tS256 {
+		return fmt.Errorf("%w: client certificate doesn't match token binding", models.ErrInvalidToken)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package keyimpl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return certificate
+}
+
+func TestProvider_VerifyCertificateBinding(t *testing.T) {
+	certificate := newTestCertificate(t, "billing")
+	otherCertificate := newTestCertificate(t, "reporting")
+	sum := sha256.Sum256(certificate.Raw)
+	bound := &models.Claims{Cnf: models.Confirmation{X5tS256: base64.RawURLEncoding.EncodeToString(sum[:])}}
+	unbound := &models.Claims{}
+
+	test := []struct {
+		name        string
+		claims      *models.Claims
+		certificate *x509.Certificate
+		required    bool
+		isFail      bool
+	}{
+		{name: "Bound token with matching certificate", claims: bound, certificate: certificate, required: true},
+		{name: "Bound token with other certificate", claims: bound, certificate: otherCertificate, required: true, isFail: true},
+		{name: "Bound token without certificate", claims: bound, required: true, isFail: true},
+		{name: "Unbound token on required endpoint", claims: unbound, certificate: certificate, required: true, isFail: true},
+		{name: "Unbound token on optional endpoint", claims: unbound, certificate: certificate},
+		{name: "Bound token with other certificate on optional endpoint", claims: bound, certificate: otherCertificate, isFail: true},
+		{name: "Bound token without certificate on optional endpoint", claims: bound, isFail: true},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewGRPCProvider(&Config{}, nil)
+
+			err := p.VerifyCertificateBinding(tt.claims, tt.certificate, tt.required)
+			if tt.isFail {
+				require.ErrorIs(t, err, models.ErrInvalidToken)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
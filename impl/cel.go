@@ -0,0 +1,260 @@
+package keyimpl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"strings"
+)
+
+// Names of the CEL object types of the user and request variables
+const (
+	_celUserType    = "keycloak.User"
+	_celRequestType = "keycloak.Request"
+)
+
+// celObjectFields are the fields of the user and request variables of conditions. Misspelled fields
+// are rejected when the condition is compiled. The values are the maps built by PolicyDocument.
+var celObjectFields = map[string]map[string]*cel.Type{
+	_celUserType: {
+		"id":          cel.StringType,
+		"kind":        cel.StringType,
+		"realm":       cel.StringType,
+		"client_id":   cel.StringType,
+		"username":    cel.StringType,
+		"email":       cel.StringType,
+		"name":        cel.StringType,
+		"family_name": cel.StringType,
+		"roles":       cel.ListType(cel.StringType),
+		"groups":      cel.ListType(cel.StringType),
+		"scopes":      cel.ListType(cel.StringType),
+		"attributes":  cel.MapType(cel.StringType, cel.DynType),
+	},
+	_celRequestType: {
+		"method":  cel.StringType,
+		"path":    cel.StringType,
+		"headers": cel.MapType(cel.StringType, cel.StringType),
+		"params":  cel.MapType(cel.StringType, cel.StringType),
+	},
+}
+
+// celObjectProvider declares the object types of the user and request variables on top of the standard types.
+type celObjectProvider struct {
+	types.Provider
+}
+
+// FindStructType implements the types.Provider interface.
+func (p celObjectProvider) FindStructType(structType string) (*types.Type, bool) {
+	if _, ok := celObjectFields[structType]; ok {
+		return types.NewTypeTypeWithParam(types.NewObjectType(structType)), true
+	}
+	return p.Provider.FindStructType(structType)
+}
+
+// FindStructFieldNames implements the types.Provider interface.
+func (p celObjectProvider) FindStructFieldNames(structType string) ([]string, bool) {
+	fields, ok := celObjectFields[structType]
+	if !ok {
+		return p.Provider.FindStructFieldNames(structType)
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	return names, true
+}
+
+// FindStructFieldType implements the types.Provider interface. Fields of the user and request are read
+// from their maps, so no field getter is returned.
+func (p celObjectProvider) FindStructFieldType(structType, fieldName string) (*types.FieldType, bool) {
+	fields, ok := celObjectFields[structType]
+	if !ok {
+		return p.Provider.FindStructFieldType(structType, fieldName)
+	}
+	fieldType, ok := fields[fieldName]
+	if !ok {
+		return nil, false
+	}
+	return &types.FieldType{Type: fieldType}, true
+}
+
+// newCELEnv creates the CEL environment conditions are compiled in.
+// Conditions can refer to the claims, user and request variables. The user and request have fixed fields,
+// while claims is a map of any values.
+func newCELEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		func(env *cel.Env) (*cel.Env, error) {
+			return cel.CustomTypeProvider(celObjectProvider{Provider: env.CELTypeProvider()})(env)
+		},
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("user", cel.ObjectType(_celUserType)),
+		cel.Variable("request", cel.ObjectType(_celRequestType)),
+	)
+}
+
+// CompileCondition compiles and type-checks the CEL condition of the rule
+// and returns a Policy that evaluates it. Evaluation errors deny access.
+func (p *Provider) CompileCondition(condition string) (models.Policy, error) {
+	p.celOnce.Do(func() {
+		p.celEnv, p.celEnvErr = newCELEnv()
+	})
+	if p.celEnvErr != nil {
+		return nil, p.celEnvErr
+	}
+
+	ast, issues := p.celEnv.Compile(condition)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("condition must evaluate to bool, got %s", ast.OutputType())
+	}
+
+	program, err := p.celEnv.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, input models.PolicyInput) error {
+		result, _, err := program.ContextEval(ctx, PolicyDocument(input))
+		if err != nil {
+			return fmt.Errorf("condition evaluation failed: %w", err)
+		}
+		if allowed, ok := result.Value().(bool); !ok || !allowed {
+			return errors.New("condition not satisfied")
+		}
+		return nil
+	}, nil
+}
+
+// compileConditions compiles the conditions of the rules and chains them before the rules' policies.
+// Returns an error naming the first rule that fails to compile.
+func (p *Provider) compileConditions(rules []models.EndpointInfo) ([]models.EndpointInfo, error) {
+	compiled := make([]models.EndpointInfo, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Condition != "" {
+			condition, err := p.CompileCondition(rule.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition of endpoint %s %s: %w", rule.Method, rule.Path, err)
+			}
+			rule.Policy = chainPolicies(condition, rule.Policy)
+		}
+		compiled = append(compiled, rule)
+	}
+
+	return compiled, nil
+}
+
+// chainPolicies returns a Policy that evaluates the policies in order and denies on the first error.
+func chainPolicies(policies ...models.Policy) models.Policy {
+	return func(ctx context.Context, input models.PolicyInput) error {
+		for _, policy := range policies {
+			if policy == nil {
+				continue
+			}
+			if err := policy(ctx, input); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// celClaims converts the raw claims to CEL values.
+func celClaims(claims *models.Claims) map[string]any {
+	if claims == nil {
+		return map[string]any{}
+	}
+	converted, _ := celValue(claims.Raw).(map[string]any)
+	if converted == nil {
+		return map[string]any{}
+	}
+	return converted
+}
+
+// celUser converts the user to a map of CEL values.
+func celUser(user models.User) map[string]any {
+	kind := "user"
+	if user.Kind == models.PrincipalServiceAccount {
+		kind = "service_account"
+	}
+
+	attributes := make(map[string]any, len(user.Attributes))
+	for name, value := range user.Attributes {
+		attributes[name] = celValue(value)
+	}
+
+	return map[string]any{
+		"id":          user.UserID,
+		"kind":        kind,
+		"realm":       user.Realm,
+		"client_id":   user.ClientID,
+		"username":    user.Username,
+		"email":       user.Email,
+		"name":        user.Name,
+		"family_name": user.FamilyName,
+		"roles":       nonNil(user.Roles),
+		"groups":      nonNil(user.Groups),
+		"scopes":      nonNil(user.Scopes),
+		"attributes":  attributes,
+	}
+}
+
+// celRequest converts the request to a map of CEL values.
+// Header names are lower-cased and multiple values are joined with ", ".
+func celRequest(request models.RequestInfo) map[string]any {
+	headers := make(map[string]any, len(request.Headers))
+	for name, values := range request.Headers {
+		headers[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+
+	params := make(map[string]any, len(request.PathParams))
+	for name, value := range request.PathParams {
+		params[name] = value
+	}
+
+	return map[string]any{
+		"method":  request.Method,
+		"path":    request.Path,
+		"headers": headers,
+		"params":  params,
+	}
+}
+
+// celValue converts JSON numbers, which CEL doesn't understand, to int64 or float64.
+func celValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		converted := make(map[string]any, len(v))
+		for key, item := range v {
+			converted[key] = celValue(item)
+		}
+		return converted
+	case []any:
+		converted := make([]any, len(v))
+		for i, item := range v {
+			converted[i] = celValue(item)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+// nonNil returns an empty slice instead of nil, so CEL sees an empty list.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,115 @@
+package keyimpl
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestProvider_RegisterEndpoint_InvalidCondition(t *testing.T) {
+	test := []struct {
+		name      string
+		condition string
+	}{
+		{name: "Syntax error", condition: `user.roles.exists(r, r == "admin"`},
+		{name: "Unknown variable", condition: `session.id == "42"`},
+		{name: "Not a bool", condition: `user.username`},
+		{name: "Misspelled request field", condition: `request.methd == "GET"`},
+		{name: "Misspelled user field", condition: `"admin" in user.rolez`},
+		{name: "Wrong field type", condition: `user.roles == "admin"`},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewHTTPProvider(&Config{}, nil)
+
+			err := p.RegisterEndpoint(
+				models.EndpointInfo{Method: "GET", Path: "/api/reports", Condition: `"admin" in user.roles`},
+				models.EndpointInfo{Method: "GET", Path: "/api/invoices", Condition: tt.condition},
+			)
+			require.Error(t, err)
+			assert.False(t, p.IsSecureEndpoint(models.SecureEndpoint{Method: "GET", Path: "/api/reports"}),
+				"rule set is rejected as a whole")
+		})
+	}
+}
+
+func TestProvider_compileConditions_UndefinedField(t *testing.T) {
+	p := NewHTTPProvider(&Config{}, nil)
+
+	_, err := p.compileConditions([]models.EndpointInfo{
+		{Method: "GET", Path: "/api/invoices", Condition: `request.headers["x-tenant"] == user.attribute.tenant_id`},
+	})
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "GET /api/invoices")
+	assert.ErrorContains(t, err, "undefined field 'attribute'")
+
+	_, err = p.compileConditions([]models.EndpointInfo{
+		{Method: "GET", Path: "/api/invoices", Condition: `claims.tenant == user.attributes.tenant && request.params.id != ""`},
+	})
+	assert.NoError(t, err, "claims and attributes accept any field")
+}
+
+func TestProvider_CompileCondition(t *testing.T) {
+	var claims models.Claims
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"sub": "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60",
+		"tenant_id": "acme",
+		"level": 3,
+		"address": {"country": "DE"}
+	}`), &claims))
+
+	input := models.PolicyInput{
+		User: models.User{
+			UserID:     "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60",
+			Kind:       models.PrincipalUser,
+			Roles:      []string{"user"},
+			Groups:     []string{"/org/finance/approvers"},
+			Attributes: map[string]any{"tenant_id": "acme"},
+		},
+		Claims: &claims,
+		Request: models.RequestInfo{
+			Method:     "GET",
+			Path:       "/api/tenants/acme/invoices",
+			PathParams: map[string]string{"tenant": "acme"},
+			Headers:    http.Header{"X-Tenant": {"acme"}},
+		},
+	}
+
+	test := []struct {
+		name      string
+		condition string
+		allowed   bool
+	}{
+		{name: "Claim equals path parameter", condition: `claims.tenant_id == request.params.tenant`, allowed: true},
+		{name: "Numeric claim", condition: `claims.level >= 3`, allowed: true},
+		{name: "Nested claim", condition: `claims.address.country == "DE"`, allowed: true},
+		{name: "Header", condition: `request.headers["x-tenant"] == user.attributes.tenant_id`, allowed: true},
+		{name: "Method and path", condition: `request.method == "GET" && request.path.startsWith("/api/tenants/")`, allowed: true},
+		{name: "Group membership", condition: `user.groups.exists(g, g.startsWith("/org/finance/"))`, allowed: true},
+		{name: "Principal kind", condition: `user.kind == "service_account"`, allowed: false},
+		{name: "False condition", condition: `"admin" in user.roles`, allowed: false},
+		{name: "Evaluation error denies", condition: `claims.missing == "x"`, allowed: false},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewHTTPProvider(&Config{}, nil)
+
+			policy, err := p.CompileCondition(tt.condition)
+			require.NoError(t, err)
+
+			err = policy(context.Background(), input)
+			if tt.allowed {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+		})
+	}
+}
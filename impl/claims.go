@@ -0,0 +1,109 @@
+package keyimpl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"strconv"
+	"time"
+)
+
+// MapClaims extracts the registered claim mappings from the token claims.
+// Returns nil if no mappings are registered, or an error if a required claim is missing
+// or a claim cannot be converted to the requested type.
+func (p *Provider) MapClaims(claims *models.Claims) (map[string]any, error) {
+	if len(p.claimMappings) == 0 {
+		return nil, nil
+	}
+
+	attributes := make(map[string]any, len(p.claimMappings))
+	for _, mapping := range p.claimMappings {
+		name := mapping.Name
+		if name == "" {
+			name = mapping.Path
+		}
+
+		raw, ok := claims.Lookup(mapping.Path)
+		if !ok || raw == nil {
+			if mapping.Required {
+				return nil, fmt.Errorf("required claim %q is missing", mapping.Path)
+			}
+			continue
+		}
+
+		value, err := convertClaim(raw, mapping.Type)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert claim %q: %w", mapping.Path, err)
+		}
+		attributes[name] = value
+	}
+
+	return attributes, nil
+}
+
+// convertClaim converts the raw JSON claim value to the given type.
+func convertClaim(raw any, claimType models.ClaimType) (any, error) {
+	switch claimType {
+	case models.ClaimAny:
+		return raw, nil
+	case models.ClaimString:
+		switch v := raw.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	case models.ClaimInt:
+		switch v := raw.(type) {
+		case json.Number:
+			return v.Int64()
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		}
+	case models.ClaimFloat:
+		switch v := raw.(type) {
+		case json.Number:
+			return v.Float64()
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case models.ClaimBool:
+		switch v := raw.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case models.ClaimStringSlice:
+		values, ok := raw.([]any)
+		if !ok {
+			values = []any{raw}
+		}
+		result := make([]string, 0, len(values))
+		for _, value := range values {
+			converted, err := convertClaim(value, models.ClaimString)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, converted.(string))
+		}
+		return result, nil
+	case models.ClaimTime:
+		switch v := raw.(type) {
+		case json.Number:
+			seconds, err := v.Float64()
+			if err != nil {
+				return nil, err
+			}
+			return time.UnixMilli(int64(seconds * 1000)).UTC(), nil
+		case string:
+			return time.Parse(time.RFC3339, v)
+		}
+	default:
+		return nil, fmt.Errorf("unknown claim type %d", claimType)
+	}
+
+	return nil, fmt.Errorf("unexpected value of type %T", raw)
+}
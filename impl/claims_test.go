@@ -0,0 +1,97 @@
+package keyimpl
+
+import (
+	"encoding/json"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestProvider_MapClaims(t *testing.T) {
+	payload := []byte(`{
+		"tenant_id": "acme",
+		"locale": "de",
+		"employee_number": "4711",
+		"level": 3,
+		"score": 0.75,
+		"contractor": "true",
+		"cost_centers": ["cc-1", "cc-2"],
+		"manager": "jdoe",
+		"hired_at": 1700000000,
+		"address": {"country": "DE"}
+	}`)
+
+	test := []struct {
+		name     string
+		mappings []models.ClaimMapping
+		expected map[string]any
+		isFail   bool
+	}{
+		{
+			name:     "No mappings",
+			expected: nil,
+		},
+		{
+			name: "Typed conversions",
+			mappings: []models.ClaimMapping{
+				{Path: "tenant_id", Type: models.ClaimString},
+				{Name: "employee", Path: "employee_number", Type: models.ClaimInt},
+				{Path: "level", Type: models.ClaimInt},
+				{Path: "score", Type: models.ClaimFloat},
+				{Path: "contractor", Type: models.ClaimBool},
+				{Path: "cost_centers", Type: models.ClaimStringSlice},
+				{Name: "managers", Path: "manager", Type: models.ClaimStringSlice},
+				{Path: "hired_at", Type: models.ClaimTime},
+				{Name: "country", Path: "address.country", Type: models.ClaimString},
+				{Path: "locale"},
+			},
+			expected: map[string]any{
+				"tenant_id":    "acme",
+				"employee":     int64(4711),
+				"level":        int64(3),
+				"score":        0.75,
+				"contractor":   true,
+				"cost_centers": []string{"cc-1", "cc-2"},
+				"managers":     []string{"jdoe"},
+				"hired_at":     time.Unix(1700000000, 0).UTC(),
+				"country":      "DE",
+				"locale":       "de",
+			},
+		},
+		{
+			name:     "Optional claim is missing",
+			mappings: []models.ClaimMapping{{Path: "department", Type: models.ClaimString}},
+			expected: map[string]any{},
+		},
+		{
+			name:     "Required claim is missing",
+			mappings: []models.ClaimMapping{{Path: "department", Type: models.ClaimString, Required: true}},
+			isFail:   true,
+		},
+		{
+			name:     "Conversion failure",
+			mappings: []models.ClaimMapping{{Path: "tenant_id", Type: models.ClaimInt}},
+			isFail:   true,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims models.Claims
+			require.NoError(t, json.Unmarshal(payload, &claims))
+
+			p := NewHTTPProvider(&Config{}, nil, WithClaimMappings(tt.mappings...))
+			attributes, err := p.MapClaims(&claims)
+
+			if tt.isFail {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, attributes)
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package keyimpl
 
 import (
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"regexp"
 	"time"
 )
 
@@ -8,8 +12,8 @@ import (
 // including the URI for the public JWK, the timeout for updating the JWK, and the client ID.
 type Config struct {
 	// PublicJWKUri - URI to get the public JWK.
-	// Must be set in the configuration (environment variables or file).
-	PublicJWKUri string `env:"PUBLIC_JWK_URI" json:"public_jwk_uri" yaml:"public_jwk_uri" validate:"required"`
+	// Must be set in the configuration (environment variables or file) unless Realms are configured.
+	PublicJWKUri string `env:"PUBLIC_JWK_URI" json:"public_jwk_uri" yaml:"public_jwk_uri" validate:"required_without=Realms"`
 
 	// RefreshJWKTimeout - timeout for JWK refresh.
 	// If not specified, the default value of 3 hours is used.
@@ -18,4 +22,140 @@ type Config struct {
 	// ClientID - client identifier for authentication.
 	// Must be specified in the configuration (environment variables or file).
 	ClientID string `env:"CLIENT_ID" json:"client_id" yaml:"client_id" validate:"required"`
+
+	// Realms - trusted realms of a multi-realm provider. Tokens are verified against the realm matching
+	// their iss claim and tokens of other issuers are rejected. If not specified, PublicJWKUri is used.
+	Realms []Realm `json:"realms" yaml:"realms" validate:"dive"`
+
+	// VerifyAudience - whether the aud claim of tokens must contain the client ID of their realm.
+	// Keycloak adds the client to the audience only with an audience mapper, so the check is disabled by default.
+	VerifyAudience bool `env:"VERIFY_AUDIENCE" json:"verify_audience" yaml:"verify_audience"`
+
+	// CheckRevocation - whether the jti of tokens is looked up in the denylist filled by Provider.RevokeToken.
+	// It costs a Redis round trip per verification, so it's disabled by default.
+	CheckRevocation bool `env:"CHECK_REVOCATION" json:"check_revocation" yaml:"check_revocation"`
+
+	// IssuerPattern - regular expression the issuer of every realm returned by a TenantResolver must match,
+	// e.g. "https://sso\.example\.com/realms/[a-z0-9-]+". It's matched against the whole issuer and protects
+	// against fetching keys from hosts named in forged tokens. If not specified, resolved realms aren't trusted.
+	IssuerPattern string `env:"ISSUER_PATTERN" json:"issuer_pattern" yaml:"issuer_pattern"`
+
+	// RealmCacheSize - maximum number of realms whose JWK sets are kept in memory.
+	// If not specified, the default value of 100 is used.
+	RealmCacheSize int `env:"REALM_CACHE_SIZE" json:"realm_cache_size" yaml:"realm_cache_size" env-default:"100"`
+
+	// RealmIdleTimeout - how long an unused realm is kept in memory.
+	// If not specified, the default value of 1 hour is used.
+	RealmIdleTimeout time.Duration `env:"REALM_IDLE_TIMEOUT" json:"realm_idle_timeout" yaml:"realm_idle_timeout" env-default:"1h"`
+
+	// IssuerURI - URI of the realm, e.g. "http://localhost:8180/realms/example-realm".
+	// Used to discover the token endpoint when TokenURI isn't set.
+	IssuerURI string `env:"ISSUER_URI" json:"issuer_uri" yaml:"issuer_uri"`
+
+	// TokenURI - URI of the token endpoint used to obtain outbound tokens.
+	// If not specified, it is discovered from IssuerURI.
+	TokenURI string `env:"TOKEN_URI" json:"token_uri" yaml:"token_uri"`
+
+	// ClientSecret - secret used to authenticate the client at the token endpoint.
+	ClientSecret string `env:"CLIENT_SECRET" json:"client_secret" yaml:"client_secret"`
+
+	// ClientAssertionKey - PEM encoded private key used to authenticate the client with a signed JWT
+	// (private_key_jwt) instead of ClientSecret.
+	ClientAssertionKey string `env:"CLIENT_ASSERTION_KEY" json:"client_assertion_key" yaml:"client_assertion_key"`
+
+	// ClientAssertionKeyFile - path to a PEM file with the private key used for private_key_jwt.
+	// Used when ClientAssertionKey isn't set.
+	ClientAssertionKeyFile string `env:"CLIENT_ASSERTION_KEY_FILE" json:"client_assertion_key_file" yaml:"client_assertion_key_file"`
+
+	// ClientAssertionKeyID - key ID put in the header of the client assertion.
+	ClientAssertionKeyID string `env:"CLIENT_ASSERTION_KEY_ID" json:"client_assertion_key_id" yaml:"client_assertion_key_id"`
+
+	// TokenScopes - scopes requested for outbound tokens.
+	TokenScopes []string `env:"TOKEN_SCOPES" env-separator:"," json:"token_scopes" yaml:"token_scopes"`
+
+	// TokenRefreshSkew - how long before expiry an outbound token is refreshed.
+	// If not specified, the default value of 30 seconds is used.
+	TokenRefreshSkew time.Duration `env:"TOKEN_REFRESH_SKEW" json:"token_refresh_skew" yaml:"token_refresh_skew" env-default:"30s"`
+
+	// PrincipalClaim - claim used as the user ID, e.g. "sub", "preferred_username" or "client_id".
+	// Nested claims can be addressed with a dot-separated path. If not specified, "sub" is used.
+	PrincipalClaim string `env:"PRINCIPAL_CLAIM" json:"principal_claim" yaml:"principal_claim" env-default:"sub"`
+
+	// SubjectPolicy - policy the user ID must satisfy: "uuid4", "uuid" (any version), "regex" or "none".
+	// If not specified, "uuid4" is used. A custom policy can be set with WithSubjectValidator.
+	SubjectPolicy string `env:"SUBJECT_POLICY" json:"subject_policy" yaml:"subject_policy" env-default:"uuid4"`
+
+	// SubjectPattern - regular expression the user ID must match when SubjectPolicy is "regex".
+	SubjectPattern string `env:"SUBJECT_PATTERN" json:"subject_pattern" yaml:"subject_pattern"`
+
+	// DecryptionKeys - PEM encoded private keys used to decrypt encrypted (JWE) access tokens.
+	// Each key gets its RFC 7638 thumbprint as key ID.
+	DecryptionKeys string `env:"DECRYPTION_KEYS" json:"decryption_keys" yaml:"decryption_keys"`
+
+	// DecryptionKeysFile - path to a JWK set (JSON) or PEM file with the private keys used to decrypt access tokens.
+	// Keys of a JWK set are selected by their kid, which allows rotating keys without downtime.
+	DecryptionKeysFile string `env:"DECRYPTION_KEYS_FILE" json:"decryption_keys_file" yaml:"decryption_keys_file"`
+
+	// DecryptionAlgorithms - key management algorithms accepted in the alg header of encrypted access tokens.
+	// If not specified, RSA-OAEP, RSA-OAEP-256 and the ECDH-ES algorithms are accepted.
+	DecryptionAlgorithms []string `env:"DECRYPTION_ALGORITHMS" env-separator:"," json:"decryption_algorithms" yaml:"decryption_algorithms"`
+
+	// DPoPProofLifetime - how far the DPoP proof iat may deviate from the current time.
+	// If not specified, the default value of 1 minute is used.
+	DPoPProofLifetime time.Duration `env:"DPOP_PROOF_LIFETIME" json:"dpop_proof_lifetime" yaml:"dpop_proof_lifetime" env-default:"1m"`
+
+	// PermissionMode - how Keycloak Authorization Services permissions are enforced: "token" checks the
+	// authorization claim of an RPT, "decision" asks the token endpoint for a decision (response_mode=decision).
+	// If not specified, "token" is used.
+	PermissionMode string `env:"PERMISSION_MODE" json:"permission_mode" yaml:"permission_mode" env-default:"token"`
+
+	// DecisionCacheTTL - how long permission decisions are cached in "decision" mode.
+	// If not specified, the default value of 1 minute is used.
+	DecisionCacheTTL time.Duration `env:"DECISION_CACHE_TTL" json:"decision_cache_ttl" yaml:"decision_cache_ttl" env-default:"1m"`
+
+	// ACRValues - ordered list of authentication context class references, from the weakest to the strongest.
+	// Used to compare the token's acr claim against the minimum level required by an endpoint.
+	// If not specified, numeric levels (Keycloak LoA) are compared as numbers and other values must match exactly.
+	ACRValues []string `env:"ACR_VALUES" env-separator:"," json:"acr_values" yaml:"acr_values"`
+
+	// PolicyBundle - path to an OPA policy bundle (directory or .tar.gz) evaluated by keypolicy.RegoProvider.
+	PolicyBundle string `env:"POLICY_BUNDLE" json:"policy_bundle" yaml:"policy_bundle"`
+
+	// PolicyQuery - Rego query evaluated by keypolicy.RegoProvider. The result is either a boolean or
+	// an object with an "allow" boolean and optional "reasons". If not specified, "data.keycloak.authz" is used.
+	PolicyQuery string `env:"POLICY_QUERY" json:"policy_query" yaml:"policy_query" env-default:"data.keycloak.authz"`
+}
+
+// Validate checks the configuration, so that a misconfiguration fails at startup instead of rejecting
+// every token at runtime. It checks the required fields, the subject policy and pattern and the issuer pattern.
+//
+// Example:
+//
+//	if err := config.Validate(); err != nil {
+//	    log.Fatal(err)
+//	}
+//	provider := NewHTTPProvider(config, redisClient)
+func (c *Config) Validate() error {
+	var errs []error
+	if err := validator.New().Struct(c); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch c.SubjectPolicy {
+	case "", SubjectPolicyUUID4, SubjectPolicyUUID, SubjectPolicyNone:
+	case SubjectPolicyRegex:
+		if _, err := regexp.Compile(c.SubjectPattern); err != nil {
+			errs = append(errs, fmt.Errorf("invalid subject pattern: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown subject policy %q", c.SubjectPolicy))
+	}
+
+	if c.IssuerPattern != "" {
+		if _, err := regexp.Compile("^(?:" + c.IssuerPattern + ")$"); err != nil {
+			errs = append(errs, fmt.Errorf("invalid issuer pattern: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,57 @@
+package keyimpl
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	test := []struct {
+		name   string
+		config Config
+		errMsg string
+	}{
+		{
+			name:   "Valid",
+			config: Config{PublicJWKUri: "http://localhost/certs", ClientID: "aibolit-api"},
+		},
+		{
+			name:   "Valid regex policy",
+			config: Config{PublicJWKUri: "http://localhost/certs", ClientID: "aibolit-api", SubjectPolicy: SubjectPolicyRegex, SubjectPattern: "^svc-[a-z]+$"},
+		},
+		{
+			name:   "Missing client ID",
+			config: Config{PublicJWKUri: "http://localhost/certs"},
+			errMsg: "ClientID",
+		},
+		{
+			name:   "Unknown subject policy",
+			config: Config{PublicJWKUri: "http://localhost/certs", ClientID: "aibolit-api", SubjectPolicy: "uuid7"},
+			errMsg: `unknown subject policy "uuid7"`,
+		},
+		{
+			name:   "Invalid subject pattern",
+			config: Config{PublicJWKUri: "http://localhost/certs", ClientID: "aibolit-api", SubjectPolicy: SubjectPolicyRegex, SubjectPattern: "svc-("},
+			errMsg: "invalid subject pattern",
+		},
+		{
+			name:   "Invalid issuer pattern",
+			config: Config{PublicJWKUri: "http://localhost/certs", ClientID: "aibolit-api", IssuerPattern: "https://sso\\.example\\.com/realms/[a-z"},
+			errMsg: "invalid issuer pattern",
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package keyimpl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"net/http"
+	"strings"
+)
+
+// Discover fetches the OpenID Provider metadata of the realm identified by the issuer URI.
+func Discover(ctx context.Context, client *http.Client, issuerURI string) (models.OpenIDConfiguration, error) {
+	uri := strings.TrimSuffix(issuerURI, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return models.OpenIDConfiguration{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return models.OpenIDConfiguration{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return models.OpenIDConfiguration{}, fmt.Errorf("discovery endpoint returned status %d", resp.StatusCode)
+	}
+
+	var configuration models.OpenIDConfiguration
+	if err = json.NewDecoder(resp.Body).Decode(&configuration); err != nil {
+		return models.OpenIDConfiguration{}, fmt.Errorf("cannot decode openid configuration: %w", err)
+	}
+
+	return configuration, nil
+}
+
+// TokenEndpoint returns the configured TokenURI or discovers the token endpoint from IssuerURI.
+func (c *Config) TokenEndpoint(ctx context.Context, client *http.Client) (string, error) {
+	if c.TokenURI != "" {
+		return c.TokenURI, nil
+	}
+
+	if c.IssuerURI == "" {
+		return "", fmt.Errorf("neither token uri nor issuer uri is configured")
+	}
+
+	configuration, err := Discover(ctx, client, c.IssuerURI)
+	if err != nil {
+		return "", err
+	}
+
+	if configuration.TokenEndpoint == "" {
+		return "", fmt.Errorf("openid configuration has no token endpoint")
+	}
+
+	return configuration.TokenEndpoint, nil
+}
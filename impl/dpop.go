@@ -0,0 +1,140 @@
+package keyimpl
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwk"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Redis key prefix of the seen DPoP proof identifiers
+const _dpopJTIPrefix = "dpop-jti:"
+
+// DPoPSigningAlgorithms lists the asymmetric algorithms accepted for DPoP proofs.
+var DPoPSigningAlgorithms = []string{
+	"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA",
+}
+
+// dpopClaims represents the claims of a DPoP proof.
+type dpopClaims struct {
+	jwt.RegisteredClaims
+
+	// HTM is the HTTP method of the request the proof was created for.
+	HTM string `json:"htm"`
+
+	// HTU is the HTTP URL of the request the proof was created for, without query and fragment.
+	HTU string `json:"htu"`
+
+	// ATH is the base64url encoded SHA-256 hash of the access token.
+	ATH string `json:"ath"`
+}
+
+// VerifyDPoP verifies the DPoP proof presented with the access token (RFC 9449).
+// It checks the proof signature with the embedded public key, that the proof was created for the request
+// method and URL and for this access token, that the key thumbprint matches the token's cnf.jkt,
+// and that the proof jti wasn't seen before.
+// In case of an error, returns an error wrapping ErrInvalidDPoPProof.
+func (p *Provider) VerifyDPoP(ctx context.Context, proof, method, uri, accessToken, jkt string) error {
+	var thumbprint string
+	token, err := jwt.ParseWithClaims(proof, &dpopClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, fmt.Errorf("unexpected typ %q", typ)
+		}
+
+		header, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("missing jwk header")
+		}
+		serializedKey, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwk.ParseKey(serializedKey)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case jwk.RSAPrivateKey, jwk.ECDSAPrivateKey, jwk.OKPPrivateKey, jwk.SymmetricKey:
+			return nil, errors.New("jwk header must contain a public key")
+		}
+
+		sum, err := key.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		thumbprint = base64.RawURLEncoding.EncodeToString(sum)
+
+		var rawKey interface{}
+		if err = key.Raw(&rawKey); err != nil {
+			return nil, err
+		}
+		return rawKey, nil
+	}, jwt.WithValidMethods(DPoPSigningAlgorithms), jwt.WithIssuedAt(), jwt.WithLeeway(p.dpopProofLifetime()))
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrInvalidDPoPProof, err)
+	}
+
+	claims := token.Claims.(*dpopClaims)
+	switch {
+	case claims.ID == "":
+		return fmt.Errorf("%w: missing jti", models.ErrInvalidDPoPProof)
+	case claims.IssuedAt == nil || time.Since(claims.IssuedAt.Time) > p.dpopProofLifetime():
+		return fmt.Errorf("%w: proof is too old", models.ErrInvalidDPoPProof)
+	case claims.HTM != method:
+		return fmt.Errorf("%w: htm doesn't match request method", models.ErrInvalidDPoPProof)
+	case normalizeHTU(claims.HTU) != normalizeHTU(uri):
+		return fmt.Errorf("%w: htu doesn't match request url", models.ErrInvalidDPoPProof)
+	case claims.ATH != accessTokenHash(accessToken):
+		return fmt.Errorf("%w: ath doesn't match access token", models.ErrInvalidDPoPProof)
+	case thumbprint != jkt:
+		return fmt.Errorf("%w: key doesn't match token binding", models.ErrInvalidDPoPProof)
+	}
+
+	fresh, err := p.redis.SetNX(ctx, _dpopJTIPrefix+thumbprint+":"+claims.ID, 1, 2*p.dpopProofLifetime()).Result()
+	if err != nil {
+		return fmt.Errorf("%w: cannot track jti: %v", models.ErrInvalidDPoPProof, err)
+	}
+	if !fresh {
+		return fmt.Errorf("%w: proof was already used", models.ErrInvalidDPoPProof)
+	}
+
+	return nil
+}
+
+// dpopProofLifetime returns how far the DPoP proof iat may deviate from the current time.
+func (p *Provider) dpopProofLifetime() time.Duration {
+	if p.config.DPoPProofLifetime > 0 {
+		return p.config.DPoPProofLifetime
+	}
+	return time.Minute
+}
+
+// accessTokenHash returns the value of the ath claim for the access token.
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// normalizeHTU normalizes the URL for comparison, dropping query and fragment
+// and lower-casing scheme and host (RFC 9449, section 4.3).
+func normalizeHTU(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed.String()
+}
@@ -0,0 +1,204 @@
+package keyimpl
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	server := miniredis.RunT(t)
+	return redis.NewClient(&redis.Options{Addr: server.Addr()})
+}
+
+// dpopKey is a client key pair creating DPoP proofs.
+type dpopKey struct {
+	private *ecdsa.PrivateKey
+	public  map[string]interface{}
+	jkt     string
+}
+
+func newDPoPKey(t *testing.T) dpopKey {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	key, err := jwk.New(&private.PublicKey)
+	require.NoError(t, err)
+	sum, err := key.Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+
+	serialized, err := json.Marshal(key)
+	require.NoError(t, err)
+	var public map[string]interface{}
+	require.NoError(t, json.Unmarshal(serialized, &public))
+
+	return dpopKey{private: private, public: public, jkt: base64.RawURLEncoding.EncodeToString(sum)}
+}
+
+func (k dpopKey) proof(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = k.public
+
+	proof, err := token.SignedString(k.private)
+	require.NoError(t, err)
+	return proof
+}
+
+func TestProvider_VerifyDPoP(t *testing.T) {
+	const (
+		accessToken = "access-token"
+		uri         = "https://api.example.com/payouts"
+	)
+	key := newDPoPKey(t)
+	otherKey := newDPoPKey(t)
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"jti": "proof-1",
+			"htm": "POST",
+			"htu": "https://API.example.com/payouts?page=2",
+			"iat": time.Now().Unix(),
+			"ath": accessTokenHash(accessToken),
+		}
+	}
+
+	test := []struct {
+		name   string
+		proof  func() string
+		jkt    string
+		isFail bool
+	}{
+		{
+			name:  "Valid proof",
+			proof: func() string { return key.proof(t, validClaims()) },
+			jkt:   key.jkt,
+		},
+		{
+			name: "Wrong method",
+			proof: func() string {
+				claims := validClaims()
+				claims["htm"] = "GET"
+				return key.proof(t, claims)
+			},
+			jkt:    key.jkt,
+			isFail: true,
+		},
+		{
+			name: "Wrong url",
+			proof: func() string {
+				claims := validClaims()
+				claims["htu"] = "https://api.example.com/refunds"
+				return key.proof(t, claims)
+			},
+			jkt:    key.jkt,
+			isFail: true,
+		},
+		{
+			name: "Wrong access token hash",
+			proof: func() string {
+				claims := validClaims()
+				claims["ath"] = accessTokenHash("other-token")
+				return key.proof(t, claims)
+			},
+			jkt:    key.jkt,
+			isFail: true,
+		},
+		{
+			name: "Expired proof",
+			proof: func() string {
+				claims := validClaims()
+				claims["iat"] = time.Now().Add(-5 * time.Minute).Unix()
+				return key.proof(t, claims)
+			},
+			jkt:    key.jkt,
+			isFail: true,
+		},
+		{
+			name: "Missing jti",
+			proof: func() string {
+				claims := validClaims()
+				delete(claims, "jti")
+				return key.proof(t, claims)
+			},
+			jkt:    key.jkt,
+			isFail: true,
+		},
+		{
+			name:   "Key doesn't match binding",
+			proof:  func() string { return otherKey.proof(t, validClaims()) },
+			jkt:    key.jkt,
+			isFail: true,
+		},
+		{
+			name: "Wrong typ",
+			proof: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodES256, validClaims())
+				token.Header["jwk"] = key.public
+				proof, err := token.SignedString(key.private)
+				require.NoError(t, err)
+				return proof
+			},
+			jkt:    key.jkt,
+			isFail: true,
+		},
+		{
+			name: "Signed with another key",
+			proof: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodES256, validClaims())
+				token.Header["typ"] = "dpop+jwt"
+				token.Header["jwk"] = key.public
+				proof, err := token.SignedString(otherKey.private)
+				require.NoError(t, err)
+				return proof
+			},
+			jkt:    key.jkt,
+			isFail: true,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewHTTPProvider(&Config{}, newTestRedis(t))
+
+			err := p.VerifyDPoP(context.Background(), tt.proof(), "POST", uri, accessToken, tt.jkt)
+			if tt.isFail {
+				require.ErrorIs(t, err, models.ErrInvalidDPoPProof)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestProvider_VerifyDPoP_Replay(t *testing.T) {
+	key := newDPoPKey(t)
+	p := NewHTTPProvider(&Config{}, newTestRedis(t))
+	proof := key.proof(t, jwt.MapClaims{
+		"jti": "proof-1",
+		"htm": "GET",
+		"htu": "https://api.example.com/payouts",
+		"iat": time.Now().Unix(),
+		"ath": accessTokenHash("access-token"),
+	})
+
+	err := p.VerifyDPoP(context.Background(), proof, "GET", "https://api.example.com/payouts", "access-token", key.jkt)
+	require.NoError(t, err)
+
+	err = p.VerifyDPoP(context.Background(), proof, "GET", "https://api.example.com/payouts", "access-token", key.jkt)
+	assert.ErrorIs(t, err, models.ErrInvalidDPoPProof)
+}
@@ -0,0 +1,139 @@
+package keyimpl
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jwk"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// _defaultDecryptionAlgorithms are the key management algorithms accepted when none are configured.
+var _defaultDecryptionAlgorithms = []string{
+	string(jwa.RSA_OAEP),
+	string(jwa.RSA_OAEP_256),
+	string(jwa.ECDH_ES),
+	string(jwa.ECDH_ES_A128KW),
+	string(jwa.ECDH_ES_A192KW),
+	string(jwa.ECDH_ES_A256KW),
+}
+
+// IsEncryptedToken reports whether the token string is a JWE in compact serialization.
+func IsEncryptedToken(tokenString string) bool {
+	return strings.Count(tokenString, ".") == 4
+}
+
+// ReloadDecryptionKeys loads the decryption keys from the configuration, replacing the current ones.
+// Call it after adding a new key to the configured file to rotate keys. In case of an error,
+// the current keys stay in use.
+func (p *Provider) ReloadDecryptionKeys() error {
+	keySet, err := p.loadDecryptionKeys()
+	if err != nil {
+		return err
+	}
+
+	p.decryptionKeys.Store(&keySet)
+	return nil
+}
+
+// initDecryptionKeys loads the configured decryption keys when the provider is created.
+// Encrypted tokens are rejected until the keys are loaded, so a failure is logged as an error.
+func (p *Provider) initDecryptionKeys() {
+	if err := p.ReloadDecryptionKeys(); err != nil {
+		p.logger.Error("Failed to load decryption keys, encrypted tokens will be rejected",
+			slog.String("err", err.Error()))
+	}
+}
+
+// DecryptToken decrypts the JWE access token and returns the nested signed token.
+// Only the configured key management algorithms are accepted (see Config.DecryptionAlgorithms).
+// The key is selected by the kid header; if it is missing or unknown, every configured key is tried.
+func (p *Provider) DecryptToken(ctx context.Context, tokenString string) (string, error) {
+	keySet := p.decryptionKeys.Load()
+	if keySet == nil || (*keySet).Len() == 0 {
+		return "", fmt.Errorf("no decryption keys configured")
+	}
+
+	message, err := jwe.Parse([]byte(tokenString))
+	if err != nil {
+		return "", err
+	}
+	headers := message.ProtectedHeaders()
+	if !slices.Contains(p.decryptionAlgorithms(), string(headers.Algorithm())) {
+		return "", fmt.Errorf("key management algorithm %q isn't allowed", headers.Algorithm())
+	}
+
+	candidates := make([]jwk.Key, 0, (*keySet).Len())
+	if key, found := (*keySet).LookupKeyID(headers.KeyID()); found {
+		candidates = append(candidates, key)
+	} else {
+		for iter := (*keySet).Iterate(ctx); iter.Next(ctx); {
+			candidates = append(candidates, iter.Pair().Value.(jwk.Key))
+		}
+	}
+
+	for _, key := range candidates {
+		payload, err := jwe.Decrypt([]byte(tokenString), headers.Algorithm(), key)
+		if err == nil {
+			return string(payload), nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot decrypt token with kid %q", headers.KeyID())
+}
+
+// decryptionAlgorithms returns the configured key management algorithms or the default ones.
+func (p *Provider) decryptionAlgorithms() []string {
+	if len(p.config.DecryptionAlgorithms) > 0 {
+		return p.config.DecryptionAlgorithms
+	}
+	return _defaultDecryptionAlgorithms
+}
+
+// loadDecryptionKeys reads the private keys from Config.DecryptionKeys and Config.DecryptionKeysFile.
+func (p *Provider) loadDecryptionKeys() (jwk.Set, error) {
+	keySet := jwk.NewSet()
+
+	sources := []string{p.config.DecryptionKeys}
+	if p.config.DecryptionKeysFile != "" {
+		content, err := os.ReadFile(p.config.DecryptionKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read decryption keys: %w", err)
+		}
+		sources = append(sources, string(content))
+	}
+
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+
+		parsed, err := jwk.Parse([]byte(source), jwk.WithPEM(!strings.HasPrefix(source, "{")))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse decryption keys: %w", err)
+		}
+
+		for i := 0; i < parsed.Len(); i++ {
+			key, _ := parsed.Get(i)
+			if key.KeyID() == "" {
+				sum, err := key.Thumbprint(crypto.SHA256)
+				if err != nil {
+					return nil, err
+				}
+				if err = key.Set(jwk.KeyIDKey, base64.RawURLEncoding.EncodeToString(sum)); err != nil {
+					return nil, err
+				}
+			}
+			keySet.Add(key)
+		}
+	}
+
+	return keySet, nil
+}
@@ -2,7 +2,11 @@ package keyimpl
 
 import (
 	"context"
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
 	"github.com/lestrrat-go/jwx/jwk"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"time"
 )
 
 // Redis key
@@ -12,28 +16,78 @@ const _jwkSet = "jwk-set"
 // If the JWK is already in the cache, it is deserialized and returned. If the JWK is not in the cache, it is loaded
 // from the remote server and then stored in the cache for future requests.
 func (p *Provider) FetchJWKSet(ctx context.Context) (jwk.Set, error) {
-	result, err := p.redis.Get(ctx, _jwkSet).Result()
+	return p.FetchRealmJWKSet(ctx, p.defaultRealm())
+}
+
+// FetchRealmJWKSet is like FetchJWKSet, but retrieves the JWK set of the realm.
+// The sets of different realms are cached independently. Sets of realms with an issuer are additionally
+// kept in memory in a bounded LRU for RefreshJWKTimeout; realms idle for Config.RealmIdleTimeout are evicted.
+func (p *Provider) FetchRealmJWKSet(ctx context.Context, realm Realm) (keySet jwk.Set, err error) {
+	ctx, span := p.tracer.Start(ctx, "keycloak.FetchJWKSet", trace.WithAttributes(attrIssuer.String(realm.Issuer)))
+	defer func() { endSpan(span, err, "jwks_fetch_failed") }()
+
+	if realm.Issuer == "" {
+		return p.fetchJWKSet(ctx, _jwkSet, realm)
+	}
+
+	now := time.Now()
+	if entry, ok := p.realmCache.get(realm.Issuer, now, p.realmIdleTimeout()); ok && now.Sub(entry.fetchedAt) < p.config.RefreshJWKTimeout {
+		span.SetAttributes(attrJWKSSource.String(keymetrics.SourceMemory))
+		p.metrics.JWKSFetched(keymetrics.SourceMemory, keymetrics.OutcomeSuccess, time.Since(now))
+		return entry.keySet, nil
+	}
+
+	keySet, err = p.fetchJWKSet(ctx, _jwkSet+":"+realm.Issuer, realm)
+	if err != nil {
+		return nil, err
+	}
+
+	p.realmCache.put(realmEntry{realm: realm, keySet: keySet, fetchedAt: now, usedAt: now}, p.realmCacheSize(), p.realmIdleTimeout())
+	return keySet, nil
+}
+
+// fetchJWKSet retrieves the JWK set of the realm from the Redis cache key or from the remote server.
+func (p *Provider) fetchJWKSet(ctx context.Context, cacheKey string, realm Realm) (jwk.Set, error) {
+	start := time.Now()
+	result, err := p.redis.Get(ctx, cacheKey).Result()
 	if err == nil {
-		p.logger.Info("Getting Jwk from cache")
+		setSpanAttributes(ctx, attrJWKSSource.String(keymetrics.SourceCache))
+		p.logger.DebugContext(ctx, "Getting Jwk from cache")
 		resultSet, err := p.DeserializeJwkSet(result)
 		if err != nil {
+			p.metrics.JWKSFetched(keymetrics.SourceCache, keymetrics.OutcomeFailure, time.Since(start))
 			return nil, err
 		}
+		p.metrics.JWKSFetched(keymetrics.SourceCache, keymetrics.OutcomeSuccess, time.Since(start))
 		return resultSet, nil
 	}
 
-	resultSet, err := jwk.Fetch(ctx, p.config.PublicJWKUri)
+	setSpanAttributes(ctx, attrJWKSSource.String(keymetrics.SourceRemote))
+	start = time.Now()
+	resultSet, err := p.fetchRemoteJWKSet(ctx, cacheKey, realm)
+	if err != nil {
+		p.metrics.JWKSFetched(keymetrics.SourceRemote, keymetrics.OutcomeFailure, time.Since(start))
+		return nil, err
+	}
+
+	p.metrics.JWKSFetched(keymetrics.SourceRemote, keymetrics.OutcomeSuccess, time.Since(start))
+	return resultSet, nil
+}
+
+// fetchRemoteJWKSet requests the JWK set of the realm from the remote server and stores it in the Redis cache.
+func (p *Provider) fetchRemoteJWKSet(ctx context.Context, cacheKey string, realm Realm) (jwk.Set, error) {
+	resultSet, err := jwk.Fetch(ctx, realm.PublicJWKUri)
 	if err != nil {
 		return nil, err
 	}
 
-	p.logger.Info("Fetching Jwk from remote")
+	p.logger.InfoContext(ctx, "Fetching Jwk from remote", slog.String("uri", realm.PublicJWKUri))
 	serializedKeySet, err := p.SerializeJwkSet(resultSet)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = p.redis.Set(ctx, _jwkSet, serializedKeySet, p.config.RefreshJWKTimeout).Err(); err != nil {
+	if err = p.redis.Set(ctx, cacheKey, serializedKeySet, p.config.RefreshJWKTimeout).Err(); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,63 @@
+package keyimpl
+
+import (
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"log/slog"
+)
+
+// RedactionPolicy controls how personal data of users appears in the provider logs.
+type RedactionPolicy int
+
+const (
+	// RedactPII replaces the user ID with a hash and drops the username, email and name. This is the default.
+	RedactPII RedactionPolicy = iota
+
+	// RedactNone logs personal data as is. Intended for local development.
+	RedactNone
+)
+
+// Logger returns the logger of the provider.
+func (p *Provider) Logger() *slog.Logger {
+	return p.logger
+}
+
+// logDenial logs an expected rejection of a request, such as an invalid token or missing role,
+// at the denial level, which is info by default.
+func (p *Provider) logDenial(ctx context.Context, msg string, attrs ...slog.Attr) {
+	p.logger.LogAttrs(ctx, p.denialLevel, msg, attrs...)
+}
+
+// LogDenial logs a rejection of the user's request by an authorizer built on the provider, e.g. a policy engine,
+// like the provider's own denials: at the denial level and with the user redacted according to the redaction policy.
+func (p *Provider) LogDenial(ctx context.Context, msg string, user models.User, attrs ...slog.Attr) {
+	p.logDenial(ctx, msg, append([]slog.Attr{p.userAttr(user)}, attrs...)...)
+}
+
+// userAttr returns the user as a log attribute with personal data redacted according to the redaction policy.
+func (p *Provider) userAttr(user models.User) slog.Attr {
+	attrs := []any{
+		p.subjectAttr(user.UserID),
+		slog.Any("kind", user.Kind),
+		slog.String("client_id", user.ClientID),
+		slog.String("realm", user.Realm),
+		slog.Any("roles", user.Roles),
+	}
+	if p.redaction == RedactNone {
+		attrs = append(attrs,
+			slog.String("username", user.Username),
+			slog.String("email", user.Email),
+			slog.String("name", user.Name),
+			slog.String("family_name", user.FamilyName),
+		)
+	}
+	return slog.Group("user", attrs...)
+}
+
+// subjectAttr returns the user ID as a log attribute, hashed unless redaction is disabled.
+func (p *Provider) subjectAttr(subject string) slog.Attr {
+	if p.redaction == RedactNone {
+		return slog.String("subject", subject)
+	}
+	return slog.String("subject_hash", hashSubject(subject))
+}
@@ -0,0 +1,55 @@
+package keyimpl
+
+import (
+	"bytes"
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"testing"
+)
+
+func TestProvider_Logging(t *testing.T) {
+	issuer := newTestIssuer(t)
+	claims := userClaims()
+	claims["email"] = "jdoe@example.com"
+	claims["name"] = "John Doe"
+	token := issuer.sign(t, claims)
+
+	deny := func(t *testing.T, opts ...Option) string {
+		var logs bytes.Buffer
+		config := issuer.config()
+		config.PrincipalClaim = "sub"
+		config.SubjectPolicy = "uuid4"
+		logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		p := NewHTTPProvider(config, newTestRedis(t), append([]Option{WithLogger(logger)}, opts...)...)
+		require.NoError(t, p.RegisterEndpoint(models.EndpointInfo{Method: http.MethodGet, Path: "/api/reports", Roles: []string{"admin"}}))
+
+		_, err := p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports", token)
+		require.ErrorIs(t, err, models.ErrAccessDenied)
+		return logs.String()
+	}
+
+	t.Run("Personal data is redacted by default", func(t *testing.T) {
+		logs := deny(t)
+		assert.Contains(t, logs, `"level":"INFO","msg":"User doesn't have needed roles"`)
+		assert.Contains(t, logs, hashSubject("1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60"))
+		assert.NotContains(t, logs, "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60")
+		assert.NotContains(t, logs, "jdoe")
+		assert.NotContains(t, logs, "John Doe")
+		assert.NotContains(t, logs, `"level":"ERROR"`)
+	})
+
+	t.Run("Redaction disabled", func(t *testing.T) {
+		logs := deny(t, WithRedaction(RedactNone))
+		assert.Contains(t, logs, "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60")
+		assert.Contains(t, logs, "jdoe@example.com")
+	})
+
+	t.Run("Denials at debug level", func(t *testing.T) {
+		logs := deny(t, WithDenialLogLevel(slog.LevelDebug))
+		assert.NotContains(t, logs, "User doesn't have needed roles")
+	})
+}
@@ -0,0 +1,94 @@
+package keyimpl
+
+import (
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"strings"
+)
+
+// endpointPattern is an HTTP endpoint rule whose path contains "{name}" parameters, e.g. "/api/users/{id}".
+type endpointPattern struct {
+	// HTTP method of the endpoint
+	method string
+
+	// Path segments, parameters are kept as "{name}"
+	segments []string
+
+	// Access rule of the endpoint
+	rule models.EndpointInfo
+}
+
+// isPathPattern reports whether the path contains parameters.
+func isPathPattern(path string) bool {
+	return strings.Contains(path, "{")
+}
+
+// match reports whether the method and path match the pattern and returns the captured parameters.
+func (e endpointPattern) match(method, path string) (map[string]string, bool) {
+	segments := strings.Split(path, "/")
+	if e.method != method || len(segments) != len(e.segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range e.segments {
+		if name, ok := strings.CutPrefix(segment, "{"); ok && strings.HasSuffix(name, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[strings.TrimSuffix(name, "}")] = segments[i]
+			continue
+		}
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// registerHTTPEndpoint stores the rule under its method and path, replacing a rule registered for the same endpoint.
+func (p *Provider) registerHTTPEndpoint(rule models.EndpointInfo) {
+	if !isPathPattern(rule.Path) {
+		p.secureEndpoints[fmt.Sprintf("%s:%s", rule.Method, rule.Path)] = rule
+		return
+	}
+
+	pattern := endpointPattern{method: rule.Method, segments: strings.Split(rule.Path, "/"), rule: rule}
+	for i, registered := range p.endpointPatterns {
+		if registered.method == rule.Method && registered.rule.Path == rule.Path {
+			p.endpointPatterns[i] = pattern
+			return
+		}
+	}
+	p.endpointPatterns = append(p.endpointPatterns, pattern)
+}
+
+// lookupHTTPEndpoint returns the rule registered for the HTTP method and path and the path parameters
+// captured by a pattern. Exact paths take precedence over patterns, which are tried in registration order.
+func (p *Provider) lookupHTTPEndpoint(method, path string) (models.EndpointInfo, map[string]string, bool) {
+	if rule, ok := p.secureEndpoints[fmt.Sprintf("%s:%s", method, path)]; ok {
+		return rule, nil, true
+	}
+
+	for _, pattern := range p.endpointPatterns {
+		if params, ok := pattern.match(method, path); ok {
+			return pattern.rule, params, true
+		}
+	}
+
+	return models.EndpointInfo{}, nil, false
+}
+
+// Endpoint returns the rule registered for the endpoint and the path parameters captured by a pattern.
+func (p *Provider) Endpoint(endpoint models.SecureEndpoint) (models.EndpointInfo, map[string]string, bool) {
+	switch p.providerType {
+	case models.HTTPProvider:
+		return p.lookupHTTPEndpoint(endpoint.Method, endpoint.Path)
+	case models.GRPCProvider:
+		rule, ok := p.secureEndpoints[endpoint.Path]
+		return rule, nil, ok
+	default:
+		return models.EndpointInfo{}, nil, false
+	}
+}
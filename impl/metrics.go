@@ -0,0 +1,74 @@
+package keyimpl
+
+import (
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// startAuthorizationSpan starts the span of an authorization decision for the endpoint.
+func (p *Provider) startAuthorizationSpan(ctx context.Context, transport, endpoint string) (context.Context, trace.Span) {
+	return p.tracer.Start(ctx, "keycloak.Authorize", trace.WithAttributes(
+		attrTransport.String(transport),
+		attrEndpoint.String(endpoint),
+	))
+}
+
+// AuthorizeFunc makes an authorization decision. It returns the user, the claims of the verified token,
+// or nil if the token is invalid, and the error denying access.
+type AuthorizeFunc func(ctx context.Context) (models.User, *models.Claims, error)
+
+// RecordAuthorization makes the authorization decision of an authorizer built on the provider, e.g.
+// keypolicy.RegoProvider, and records it like the provider's own decisions: in a span, the authorization
+// metrics and the decision log. The endpoint is the gRPC method or "METHOD path" of an HTTP request.
+func (p *Provider) RecordAuthorization(
+	ctx context.Context,
+	transport string,
+	endpoint string,
+	rule models.EndpointInfo,
+	authorize AuthorizeFunc,
+) (models.User, error) {
+	ctx, span := p.startAuthorizationSpan(ctx, transport, endpoint)
+	start := time.Now()
+	user, claims, err := authorize(ctx)
+	p.recordAuthorization(ctx, span, authorization{
+		transport: transport,
+		endpoint:  endpoint,
+		rule:      rule,
+		user:      user,
+		claims:    claims,
+		err:       err,
+		duration:  time.Since(start),
+	})
+	return user, err
+}
+
+// authorization is an authorization decision to record.
+type authorization struct {
+	transport string
+	endpoint  string
+	rule      models.EndpointInfo
+	user      models.User
+	claims    *models.Claims
+	err       error
+	duration  time.Duration
+}
+
+// recordAuthorization records the authorization decision in metrics and the decision log and ends its span.
+func (p *Provider) recordAuthorization(ctx context.Context, span trace.Span, a authorization) {
+	span.SetAttributes(attrSubjectHash.String(hashSubject(a.user.UserID)))
+	p.logDecision(ctx, a)
+	if a.err == nil {
+		p.metrics.Authorized(a.transport, keymetrics.OutcomeAllowed, "", a.duration)
+		span.SetAttributes(attrDecision.String(keymetrics.OutcomeAllowed))
+		endSpan(span, nil, "")
+		return
+	}
+
+	reason := string(models.ReasonOf(a.err))
+	p.metrics.Authorized(a.transport, keymetrics.OutcomeDenied, reason, a.duration)
+	span.SetAttributes(attrDecision.String(keymetrics.OutcomeDenied))
+	endSpan(span, a.err, reason)
+}
@@ -0,0 +1,91 @@
+package keyimpl
+
+import (
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRecorder collects the recorded metrics as "name:label,label" strings.
+type testRecorder struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (r *testRecorder) record(record string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+func (r *testRecorder) TokenVerified(outcome, reason string, _ time.Duration) {
+	r.record("verify:" + outcome + "," + reason)
+}
+
+func (r *testRecorder) JWKSFetched(source, outcome string, _ time.Duration) {
+	r.record("jwks:" + source + "," + outcome)
+}
+
+func (r *testRecorder) Authorized(transport, outcome, reason string, _ time.Duration) {
+	r.record("authorize:" + transport + "," + outcome + "," + reason)
+}
+
+func (r *testRecorder) AuditDropped(decision string) {
+	r.record("audit_dropped:" + decision)
+}
+
+func TestProvider_Metrics(t *testing.T) {
+	issuer := newTestIssuer(t)
+	recorder := &testRecorder{}
+	config := issuer.config()
+	config.PrincipalClaim = "sub"
+	config.SubjectPolicy = "uuid4"
+	p := NewHTTPProvider(config, newTestRedis(t), WithMetrics(recorder))
+	require.NoError(t, p.RegisterEndpoint(models.EndpointInfo{Method: http.MethodGet, Path: "/api/reports", Roles: []string{"admin"}}))
+
+	_, err := p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports", issuer.sign(t, userClaims()))
+	require.ErrorIs(t, err, models.ErrAccessDenied)
+
+	expired := userClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports", issuer.sign(t, expired))
+	require.ErrorIs(t, err, models.ErrInvalidToken)
+
+	assert.Equal(t, []string{
+		"jwks:remote," + keymetrics.OutcomeSuccess,
+		"verify:success,",
+		"authorize:http,denied,missing_role",
+		"jwks:cache," + keymetrics.OutcomeSuccess,
+		"verify:failure,expired",
+		"authorize:http,denied,expired",
+	}, recorder.records)
+}
+
+func TestVerificationReason(t *testing.T) {
+	issuer := newTestIssuer(t)
+	other := newTestIssuer(t)
+	p := NewHTTPProvider(issuer.config(), newTestRedis(t))
+
+	unknownKey := jwt.NewWithClaims(jwt.SigningMethodRS256, userClaims())
+	unknownKey.Header["kid"] = "rotated-key"
+	signed, err := unknownKey.SignedString(issuer.key)
+	require.NoError(t, err)
+
+	for token, want := range map[string]models.Reason{
+		"not-a-token": models.ReasonMalformed,
+		issuer.sign(t, map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}): models.ReasonNotYetValid,
+		other.sign(t, userClaims()): models.ReasonBadSignature,
+		signed:                      models.ReasonUnknownKeyID,
+	} {
+		_, err := p.VerifyToken(context.Background(), token)
+		require.ErrorIs(t, err, models.ErrInvalidToken)
+		assert.Equal(t, want, models.ReasonOf(err), token)
+	}
+}
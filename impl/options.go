@@ -0,0 +1,125 @@
+package keyimpl
+
+import (
+	"github.com/YATAHAKI/KeycloakAuth/audit"
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"log/slog"
+	"net/http"
+)
+
+// Option configures optional settings of the Provider.
+type Option func(*Provider)
+
+// WithClaimMappings registers extra claims that are extracted from the token into models.User.Attributes.
+//
+// Example:
+//
+//	provider := NewHTTPProvider(config, redisClient, WithClaimMappings(
+//	    models.ClaimMapping{Path: "tenant_id", Type: models.ClaimString, Required: true},
+//	    models.ClaimMapping{Name: "country", Path: "address.country", Type: models.ClaimString},
+//	))
+func WithClaimMappings(mappings ...models.ClaimMapping) Option {
+	return func(p *Provider) {
+		p.claimMappings = append(p.claimMappings, mappings...)
+	}
+}
+
+// WithSubjectValidator replaces the subject policy from the configuration with a custom validator.
+//
+// Example:
+//
+//	provider := NewGRPCProvider(config, redisClient, WithSubjectValidator(func(subject string) error {
+//	    if !strings.HasPrefix(subject, "f:") {
+//	        return errors.New("only federated users are allowed")
+//	    }
+//	    return nil
+//	}))
+func WithSubjectValidator(validator SubjectValidator) Option {
+	return func(p *Provider) {
+		p.subjectValidator = validator
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to call Keycloak endpoints, e.g. for permission decisions.
+// By default, a client with a 10 seconds timeout is used.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Provider) {
+		p.httpClient = client
+	}
+}
+
+// WithTenantResolver sets the resolver of realms that aren't among Config.Realms, e.g. for realm-per-tenant
+// deployments onboarding tenants at runtime. Resolved realms must match Config.IssuerPattern.
+//
+// Example:
+//
+//	provider := NewHTTPProvider(config, redisClient, WithTenantResolver(
+//	    HostTenantResolver("https://sso.example.com/realms/{tenant}"),
+//	))
+func WithTenantResolver(resolver TenantResolver) Option {
+	return func(p *Provider) {
+		p.tenantResolver = resolver
+	}
+}
+
+// WithMetrics sets the recorder of verification and authorization metrics, e.g. keyprom.New.
+// By default, metrics are discarded.
+func WithMetrics(recorder keymetrics.Recorder) Option {
+	return func(p *Provider) {
+		p.metrics = recorder
+	}
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider of the verification and authorization spans.
+// By default, the global tracer provider is used.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(p *Provider) {
+		p.tracer = provider.Tracer(_tracerName)
+	}
+}
+
+// WithoutTracing disables the verification and authorization spans.
+func WithoutTracing() Option {
+	return func(p *Provider) {
+		p.tracer = noop.NewTracerProvider().Tracer(_tracerName)
+	}
+}
+
+// WithDecisionLog sets the sink receiving an event for every access decision.
+// The sink is called on the request path; wrap slow sinks with keyaudit.NewAsyncSink.
+//
+// Example:
+//
+//	fileSink, err := keyaudit.NewFileSink("/var/log/app/decisions.jsonl")
+//	decisionLog := keyaudit.NewAsyncSink(keyaudit.Sample(fileSink, 0.1), 1024)
+//	provider := NewHTTPProvider(config, redisClient, WithDecisionLog(decisionLog))
+func WithDecisionLog(sink keyaudit.Sink) Option {
+	return func(p *Provider) {
+		p.decisionLog = sink
+	}
+}
+
+// WithLogger sets the logger of the provider. By default, text logs are written to stdout.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Provider) {
+		p.logger = logger
+	}
+}
+
+// WithDenialLogLevel sets the level expected denials, such as invalid tokens or missing roles, are logged at.
+// By default, they are logged at info level; failures of the provider itself are always logged as errors.
+func WithDenialLogLevel(level slog.Level) Option {
+	return func(p *Provider) {
+		p.denialLevel = level
+	}
+}
+
+// WithRedaction sets how personal data of users appears in the logs. By default, RedactPII is used.
+func WithRedaction(policy RedactionPolicy) Option {
+	return func(p *Provider) {
+		p.redaction = policy
+	}
+}
@@ -1,6 +1,11 @@
 package keyimpl
 
-import "slices"
+import (
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 // IsUserHaveRoles checks if the user has at least one of the required roles.
 func (p *Provider) IsUserHaveRoles(roles []string, userRoles []string) bool {
@@ -16,3 +21,90 @@ func (p *Provider) IsUserHaveRoles(roles []string, userRoles []string) bool {
 
 	return false
 }
+
+// IsClientAllowed checks if the calling client is one of the allowed clients.
+func (p *Provider) IsClientAllowed(clients []string, clientID string) bool {
+	return len(clients) == 0 || slices.Contains(clients, clientID)
+}
+
+// IsPrincipalAllowed checks if the principal kind matches the one required by the endpoint.
+func (p *Provider) IsPrincipalAllowed(required models.PrincipalKind, kind models.PrincipalKind) bool {
+	return required == 0 || required == kind
+}
+
+// IsUserInGroups checks if the user is a member of at least one of the required groups.
+// A group ending with "/*" is matched hierarchically by any of its subgroups.
+func (p *Provider) IsUserInGroups(groups []string, userGroups []string) bool {
+	if len(groups) == 0 {
+		return true
+	}
+
+	for _, group := range groups {
+		prefix, hierarchical := strings.CutSuffix(group, "/*")
+		for _, userGroup := range userGroups {
+			if userGroup == group {
+				return true
+			}
+			if hierarchical && strings.HasPrefix(userGroup, prefix+"/") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// IsScopeSatisfied checks if the token scopes satisfy the required scopes.
+// With models.ScopeMatchAll every required scope must be granted, otherwise at least one of them.
+func (p *Provider) IsScopeSatisfied(required []string, match models.ScopeMatch, scopes []string) bool {
+	if len(required) == 0 {
+		return true
+	}
+
+	for _, scope := range required {
+		granted := slices.Contains(scopes, scope)
+		if granted && match != models.ScopeMatchAll {
+			return true
+		}
+		if !granted && match == models.ScopeMatchAll {
+			return false
+		}
+	}
+
+	return match == models.ScopeMatchAll
+}
+
+// IsACRSatisfied checks if the token's acr is at least as strong as the required one.
+// When Config.ACRValues is set, levels are compared by their position in that list and
+// unknown values are treated as insufficient. Otherwise numeric levels are compared as numbers
+// and any other values must match exactly.
+func (p *Provider) IsACRSatisfied(required, acr string) bool {
+	if required == "" {
+		return true
+	}
+
+	if len(p.config.ACRValues) > 0 {
+		requiredLevel := slices.Index(p.config.ACRValues, required)
+		level := slices.Index(p.config.ACRValues, acr)
+		return requiredLevel >= 0 && level >= requiredLevel
+	}
+
+	requiredLevel, errRequired := strconv.Atoi(required)
+	level, err := strconv.Atoi(acr)
+	if errRequired == nil && err == nil {
+		return level >= requiredLevel
+	}
+
+	return required == acr
+}
+
+// IsAMRSatisfied checks if the token's amr contains all the required authentication methods.
+func (p *Provider) IsAMRSatisfied(required []string, amr []string) bool {
+	for _, method := range required {
+		if !slices.Contains(amr, method) {
+			return false
+		}
+	}
+
+	return true
+}
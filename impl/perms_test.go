@@ -0,0 +1,95 @@
+package keyimpl
+
+import (
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProvider_IsACRSatisfied(t *testing.T) {
+	test := []struct {
+		name      string
+		acrValues []string
+		required  string
+		acr       string
+		expected  bool
+	}{
+		{name: "No requirement", required: "", acr: "", expected: true},
+		{name: "Numeric level is higher", required: "1", acr: "2", expected: true},
+		{name: "Numeric level is lower", required: "2", acr: "1", expected: false},
+		{name: "Non numeric exact match", required: "gold", acr: "gold", expected: true},
+		{name: "Non numeric mismatch", required: "gold", acr: "silver", expected: false},
+		{name: "Ordered level is higher", acrValues: []string{"bronze", "silver", "gold"}, required: "silver", acr: "gold", expected: true},
+		{name: "Ordered level is lower", acrValues: []string{"bronze", "silver", "gold"}, required: "gold", acr: "silver", expected: false},
+		{name: "Unknown ordered level", acrValues: []string{"bronze", "silver", "gold"}, required: "bronze", acr: "platinum", expected: false},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{config: &Config{ACRValues: tt.acrValues}}
+
+			assert.Equal(t, tt.expected, p.IsACRSatisfied(tt.required, tt.acr))
+		})
+	}
+}
+
+func TestProvider_IsAMRSatisfied(t *testing.T) {
+	p := &Provider{config: &Config{}}
+
+	assert.True(t, p.IsAMRSatisfied(nil, []string{"pwd"}))
+	assert.True(t, p.IsAMRSatisfied([]string{"otp"}, []string{"pwd", "otp"}))
+	assert.False(t, p.IsAMRSatisfied([]string{"otp", "hwk"}, []string{"pwd", "otp"}))
+}
+
+func TestProvider_IsScopeSatisfied(t *testing.T) {
+	test := []struct {
+		name     string
+		required []string
+		match    models.ScopeMatch
+		scopes   []string
+		expected bool
+	}{
+		{name: "No requirement", scopes: []string{"openid"}, expected: true},
+		{name: "Any with one granted", required: []string{"invoice:read", "invoice:write"}, scopes: []string{"invoice:write"}, expected: true},
+		{name: "Any with none granted", required: []string{"invoice:read"}, scopes: []string{"profile"}, expected: false},
+		{name: "All granted", required: []string{"invoice:read", "invoice:write"}, match: models.ScopeMatchAll, scopes: []string{"invoice:read", "invoice:write", "profile"}, expected: true},
+		{name: "All with one missing", required: []string{"invoice:read", "invoice:write"}, match: models.ScopeMatchAll, scopes: []string{"invoice:read"}, expected: false},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{config: &Config{}}
+
+			assert.Equal(t, tt.expected, p.IsScopeSatisfied(tt.required, tt.match, tt.scopes))
+		})
+	}
+}
+
+func TestProvider_IsUserInGroups(t *testing.T) {
+	userGroups := []string{"/org/finance/approvers", "/org/engineering/platform/sre"}
+
+	test := []struct {
+		name     string
+		groups   []string
+		expected bool
+	}{
+		{name: "No requirement", groups: nil, expected: true},
+		{name: "Exact match", groups: []string{"/org/finance/approvers"}, expected: true},
+		{name: "Parent wildcard", groups: []string{"/org/finance/*"}, expected: true},
+		{name: "Ancestor wildcard of nested group", groups: []string{"/org/engineering/*"}, expected: true},
+		{name: "Root wildcard", groups: []string{"/org/*"}, expected: true},
+		{name: "Parent without wildcard", groups: []string{"/org/finance"}, expected: false},
+		{name: "Sibling group", groups: []string{"/org/finance/auditors"}, expected: false},
+		{name: "Wildcard does not match name prefix", groups: []string{"/org/fin/*"}, expected: false},
+		{name: "Wildcard does not match the group itself", groups: []string{"/org/finance/approvers/*"}, expected: false},
+		{name: "One of several", groups: []string{"/org/hr/*", "/org/engineering/platform/sre"}, expected: true},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{config: &Config{}}
+
+			assert.Equal(t, tt.expected, p.IsUserInGroups(tt.groups, userGroups))
+		})
+	}
+}
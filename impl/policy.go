@@ -0,0 +1,53 @@
+package keyimpl
+
+import (
+	"context"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+)
+
+// EvaluatePolicy evaluates the rule's Policy with the user, the claims and the request described by
+// models.RequestInfo stored in the context under provider.RequestInfoKey.
+// In case of a denial, returns an error wrapping ErrAccessDenied.
+func (p *Provider) EvaluatePolicy(
+	ctx context.Context,
+	rule models.EndpointInfo,
+	user models.User,
+	claims *models.Claims,
+	path string,
+	params map[string]string,
+) error {
+	if rule.Policy == nil {
+		return nil
+	}
+
+	request := RequestInfo(ctx, rule.Method, path, params)
+	if err := rule.Policy(ctx, models.PolicyInput{User: user, Claims: claims, Request: request}); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrAccessDenied, err)
+	}
+
+	return nil
+}
+
+// RequestInfo returns models.RequestInfo stored in the context under provider.RequestInfoKey completed
+// with the path and its parameters. The method is used if the transport didn't set one.
+func RequestInfo(ctx context.Context, method, path string, params map[string]string) models.RequestInfo {
+	request, _ := ctx.Value(provider.RequestInfoKey).(models.RequestInfo)
+	request.Path = path
+	request.PathParams = params
+	if request.Method == "" {
+		request.Method = method
+	}
+	return request
+}
+
+// PolicyDocument converts the policy input to the document conditions and policy engines evaluate:
+// an object with the "claims", "user" and "request" members.
+func PolicyDocument(input models.PolicyInput) map[string]any {
+	return map[string]any{
+		"claims":  celClaims(input.Claims),
+		"user":    celUser(input.User),
+		"request": celRequest(input.Request),
+	}
+}
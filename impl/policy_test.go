@@ -0,0 +1,109 @@
+package keyimpl
+
+import (
+	"context"
+	"errors"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestProvider_LookupHTTPEndpoint(t *testing.T) {
+	p := NewHTTPProvider(&Config{}, nil)
+	require.NoError(t, p.RegisterEndpoint(
+		models.EndpointInfo{Method: "GET", Path: "/api/users/me", Roles: []string{"user"}},
+		models.EndpointInfo{Method: "GET", Path: "/api/users/{id}", Roles: []string{"admin"}},
+		models.EndpointInfo{Method: "GET", Path: "/api/tenants/{tenant}/invoices/{invoice}"},
+	))
+
+	rule, params, ok := p.lookupHTTPEndpoint("GET", "/api/users/me")
+	require.True(t, ok)
+	assert.Equal(t, []string{"user"}, rule.Roles, "exact path takes precedence")
+	assert.Nil(t, params)
+
+	rule, params, ok = p.lookupHTTPEndpoint("GET", "/api/users/42")
+	require.True(t, ok)
+	assert.Equal(t, []string{"admin"}, rule.Roles)
+	assert.Equal(t, map[string]string{"id": "42"}, params)
+
+	_, params, ok = p.lookupHTTPEndpoint("GET", "/api/tenants/acme/invoices/7")
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"tenant": "acme", "invoice": "7"}, params)
+
+	for _, path := range []string{"/api/users/", "/api/users/42/orders", "/api/tenants/acme/invoices"} {
+		_, _, ok = p.lookupHTTPEndpoint("GET", path)
+		assert.False(t, ok, path)
+	}
+	_, _, ok = p.lookupHTTPEndpoint("DELETE", "/api/users/42")
+	assert.False(t, ok)
+
+	assert.True(t, p.IsSecureEndpoint(models.SecureEndpoint{Method: "GET", Path: "/api/users/42"}))
+}
+
+func TestProvider_AuthorizeHTTP_Policy(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := NewHTTPProvider(issuer.config(), newTestRedis(t), WithClaimMappings(
+		models.ClaimMapping{Path: "tenant_id", Type: models.ClaimString},
+	))
+	require.NoError(t, p.RegisterEndpoint(
+		models.EndpointInfo{
+			Method: "PUT",
+			Path:   "/api/users/{id}",
+			Roles:  []string{"user"},
+			Policy: func(ctx context.Context, input models.PolicyInput) error {
+				if input.Request.PathParams["id"] != input.User.UserID {
+					return errors.New("users may only edit their own profile")
+				}
+				return nil
+			},
+		},
+		models.EndpointInfo{
+			Method: "GET",
+			Path:   "/api/tenants/{tenant}/invoices",
+			Policy: func(ctx context.Context, input models.PolicyInput) error {
+				tenant, _ := models.Attribute[string](input.User, "tenant_id")
+				if input.Request.PathParams["tenant"] != tenant || input.Request.Headers.Get("X-Tenant") != tenant {
+					return errors.New("tenant mismatch")
+				}
+				return nil
+			},
+		},
+	))
+
+	claims := userClaims()
+	claims["tenant_id"] = "acme"
+	token := issuer.sign(t, claims)
+	subject := claims["sub"].(string)
+
+	ctx := context.WithValue(context.Background(), provider.RequestInfoKey, models.RequestInfo{
+		Headers: http.Header{"X-Tenant": {"acme"}},
+	})
+
+	test := []struct {
+		name   string
+		method string
+		path   string
+		isFail bool
+	}{
+		{name: "Own profile", method: "PUT", path: "/api/users/" + subject},
+		{name: "Other profile", method: "PUT", path: "/api/users/9f7c1c52-1f4e-4b8e-8d0a-2b0c4f6d7e81", isFail: true},
+		{name: "Own tenant", method: "GET", path: "/api/tenants/acme/invoices"},
+		{name: "Other tenant", method: "GET", path: "/api/tenants/globex/invoices", isFail: true},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := p.AuthorizeHTTP(ctx, tt.method, tt.path, token)
+			if tt.isFail {
+				require.ErrorIs(t, err, models.ErrAccessDenied)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, subject, user.UserID)
+		})
+	}
+}
@@ -3,13 +3,24 @@ package keyimpl
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/audit"
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
 	"github.com/YATAHAKI/KeycloakAuth/models"
 	"github.com/YATAHAKI/KeycloakAuth/provider"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/cel-go/cel"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/trace"
 	"log/slog"
+	"net/http"
 	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var _ provider.AuthProvider = (*Provider)(nil)
@@ -27,14 +38,68 @@ type Provider struct {
 	// Validator
 	validate *validator.Validate
 
-	// Map of protected endpoints with their associated roles
-	secureEndpoints map[string][]string
+	// Trusted realms keyed by issuer
+	realms map[string]Realm
+
+	// Resolver of realms that aren't configured statically
+	tenantResolver TenantResolver
+
+	// Pattern resolved realm issuers must match
+	issuerPattern *regexp.Regexp
+
+	// Recently used realms and their JWK sets
+	realmCache realmCache
+
+	// Map of protected endpoints with their access rules
+	secureEndpoints map[string]models.EndpointInfo
+
+	// Protected HTTP endpoints with path parameters
+	endpointPatterns []endpointPattern
+
+	// CEL environment of the endpoint conditions, created once on first use
+	celOnce   sync.Once
+	celEnv    *cel.Env
+	celEnvErr error
+
+	// Validator of the user ID
+	subjectValidator SubjectValidator
+
+	// Private keys decrypting encrypted access tokens
+	decryptionKeys atomic.Pointer[jwk.Set]
+
+	// HTTP client used to call Keycloak endpoints
+	httpClient *http.Client
+
+	// Token endpoint URI, resolved on first use
+	endpointMu sync.Mutex
+	tokenURI   string
+
+	// Cached permission decisions
+	decisions decisionCache
+
+	// Extra claims extracted into user attributes
+	claimMappings []models.ClaimMapping
 
 	// Type of the provider (HTTP or gRPC)
 	providerType models.ProviderType
 
+	// Recorder of verification and authorization metrics
+	metrics keymetrics.Recorder
+
+	// Tracer of verification and authorization spans
+	tracer trace.Tracer
+
+	// Sink of the access decision log
+	decisionLog keyaudit.Sink
+
 	// Logger
 	logger *slog.Logger
+
+	// Level of the logs of expected denials
+	denialLevel slog.Level
+
+	// Redaction of personal data in the logs
+	redaction RedactionPolicy
 }
 
 // NewGRPCProvider creates and initializes a new Provider instance configured for gRPC endpoints.
@@ -43,6 +108,7 @@ type Provider struct {
 // Parameters:
 //   - config: Configuration settings for the provider
 //   - redis: Redis client for token management
+//   - opts: Optional settings, e.g. WithClaimMappings or WithSubjectValidator
 //
 // Returns:
 //   - *Provider: A new Provider instance configured for gRPC
@@ -54,15 +120,29 @@ type Provider struct {
 //	    Path:  "/package.service/Method",
 //	    Roles: []string{"admin"},
 //	})
-func NewGRPCProvider(config *Config, redis *redis.Client) *Provider {
-	return &Provider{
+func NewGRPCProvider(config *Config, redis *redis.Client, opts ...Option) *Provider {
+	p := &Provider{
 		config:          config,
 		redis:           redis,
 		validate:        validator.New(),
-		secureEndpoints: make(map[string][]string),
+		realms:          newRealms(config),
+		secureEndpoints: make(map[string]models.EndpointInfo),
 		providerType:    models.GRPCProvider,
 		logger:          slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		denialLevel:     slog.LevelInfo,
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		metrics:         keymetrics.Nop,
+		tracer:          defaultTracer(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.subjectValidator == nil {
+		p.subjectValidator = p.newSubjectValidator()
 	}
+	p.initIssuerPattern()
+	p.initDecryptionKeys()
+	return p
 }
 
 // NewHTTPProvider creates and initializes a new Provider instance configured for HTTP endpoints.
@@ -71,6 +151,7 @@ func NewGRPCProvider(config *Config, redis *redis.Client) *Provider {
 // Parameters:
 //   - config: Configuration settings for the provider
 //   - redis: Redis client for token management
+//   - opts: Optional settings, e.g. WithClaimMappings or WithSubjectValidator
 //
 // Returns:
 //   - *Provider: A new Provider instance configured for HTTP
@@ -83,28 +164,48 @@ func NewGRPCProvider(config *Config, redis *redis.Client) *Provider {
 //	    Path:   "/api/users",
 //	    Roles:  []string{"admin"},
 //	})
-func NewHTTPProvider(config *Config, redis *redis.Client) *Provider {
-	return &Provider{
+func NewHTTPProvider(config *Config, redis *redis.Client, opts ...Option) *Provider {
+	p := &Provider{
 		config:          config,
 		redis:           redis,
 		validate:        validator.New(),
-		secureEndpoints: make(map[string][]string),
+		realms:          newRealms(config),
+		secureEndpoints: make(map[string]models.EndpointInfo),
 		providerType:    models.HTTPProvider,
 		logger:          slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		denialLevel:     slog.LevelInfo,
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		metrics:         keymetrics.Nop,
+		tracer:          defaultTracer(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.subjectValidator == nil {
+		p.subjectValidator = p.newSubjectValidator()
 	}
+	p.initIssuerPattern()
+	p.initDecryptionKeys()
+	return p
 }
 
-// RegisterEndpoint registers a secure endpoint with associated roles
+// RegisterEndpoint registers a secure endpoint with associated roles.
+// HTTP paths may contain "{name}" segments, e.g. "/api/users/{id}"; the captured values are
+// passed to the rule's Policy in models.RequestInfo.PathParams.
+// Conditions of all rules are compiled first; if any of them is invalid, no rule is registered.
 func (p *Provider) RegisterEndpoint(rules ...models.EndpointInfo) error {
+	rules, err := p.compileConditions(rules)
+	if err != nil {
+		p.logger.Error("Failed to compile endpoint conditions", slog.String("err", err.Error()))
+		return err
+	}
+
 	for _, rule := range rules {
 		switch p.providerType {
 		case models.HTTPProvider:
-			key := fmt.Sprintf("%s:%s", rule.Method, rule.Path)
-			p.secureEndpoints[key] = rule.Roles
-			return nil
+			p.registerHTTPEndpoint(rule)
 		case models.GRPCProvider:
-			p.secureEndpoints[rule.Path] = rule.Roles
-			return nil
+			p.secureEndpoints[rule.Path] = rule
 		default:
 			return fmt.Errorf("unknown provider type")
 		}
@@ -121,17 +222,8 @@ func (p *Provider) RegisterEndpoint(rules ...models.EndpointInfo) error {
 // Returns:
 // - true if the endpoint is registered as secure, false otherwise.
 func (p *Provider) IsSecureEndpoint(rule models.SecureEndpoint) bool {
-	switch p.providerType {
-	case models.HTTPProvider:
-		key := fmt.Sprintf("%s:%s", rule.Method, rule.Path)
-		_, ok := p.secureEndpoints[key]
-		return ok
-	case models.GRPCProvider:
-		_, ok := p.secureEndpoints[rule.Path]
-		return ok
-	default:
-		return false
-	}
+	_, _, ok := p.Endpoint(rule)
+	return ok
 }
 
 // AuthorizeGRPC authorizes the user based on the passed token and endpoint path.
@@ -141,107 +233,178 @@ func (p *Provider) IsSecureEndpoint(rule models.SecureEndpoint) bool {
 // - tokenString: string with user's JWT token
 // Returns user and error (if any).
 func (p *Provider) AuthorizeGRPC(ctx context.Context, path, tokenString string) (models.User, error) {
-	token, err := p.VerifyToken(ctx, tokenString)
+	rule := p.secureEndpoints[path]
+	return p.RecordAuthorization(ctx, keymetrics.TransportGRPC, path, rule,
+		func(ctx context.Context) (models.User, *models.Claims, error) {
+			return p.authorize(ctx, path, rule, nil, tokenString)
+		})
+}
+
+// AuthorizeHTTP authorizes the user based on the passed token, HTTP method, and endpoint path.
+// Checks the validity of the token and whether the user has the necessary roles for access.
+// Parameters:
+// - method: HTTP method (e.g., "GET", "POST", "PUT", "DELETE").
+// - path: path of the protected endpoint (e.g., "/api/v1/user").
+// - tokenString: string with the user's JWT token.
+// Returns user and error (if any).
+func (p *Provider) AuthorizeHTTP(ctx context.Context, method, path, tokenString string) (models.User, error) {
+	rule, params, _ := p.lookupHTTPEndpoint(method, path)
+	return p.RecordAuthorization(ctx, keymetrics.TransportHTTP, method+" "+path, rule,
+		func(ctx context.Context) (models.User, *models.Claims, error) {
+			return p.authorize(ctx, path, rule, params, tokenString)
+		})
+}
+
+// authorize verifies the token and checks it against the rule of the endpoint.
+// The claims are returned for recording the decision and are nil if the token is invalid.
+func (p *Provider) authorize(ctx context.Context, path string, rule models.EndpointInfo, params map[string]string, tokenString string) (models.User, *models.Claims, error) {
+	user, claims, err := p.Authenticate(ctx, tokenString, rule)
 	if err != nil {
-		p.logger.Error("Failed to verify token", slog.String("err", err.Error()))
-		return models.User{}, models.ErrInvalidToken
+		return models.User{}, nil, err
 	}
 
-	claims, ok := token.Claims.(*models.Claims)
-	if !(ok && token.Valid) {
-		p.logger.Error("Failed to get claims from token")
-		return models.User{}, models.ErrInvalidToken
+	if !p.IsPrincipalAllowed(rule.Principal, user.Kind) || !p.IsClientAllowed(rule.Clients, user.ClientID) {
+		p.logDenial(ctx,
+			"Calling client isn't allowed",
+			p.userAttr(user),
+			slog.Any("allowed_clients", rule.Clients),
+			slog.Any("allowed_principal", rule.Principal),
+		)
+		return user, claims, &models.AuthError{Reason: models.ReasonClientNotAllowed, Required: rule.Clients}
 	}
 
-	if claims.Subject == "" {
-		p.logger.Error("Failed to get sub claims from token")
-		return models.User{}, models.ErrInvalidToken
+	neededRoles := rule.Roles
+	if len(neededRoles) == 0 {
+		neededRoles = []string{}
+	}
+	if !p.IsUserHaveRoles(neededRoles, claims.ResourceAccess.Client.Roles) {
+		p.logDenial(ctx,
+			"User doesn't have needed roles",
+			p.userAttr(user),
+			slog.Any("needed_roles", neededRoles),
+		)
+		return user, claims, &models.AuthError{Reason: models.ReasonMissingRole, Required: neededRoles}
 	}
 
-	if err = p.validate.Var(claims.Subject, "uuid4"); err != nil {
-		p.logger.Error("Failed to validate sub claim", slog.String("err", err.Error()))
-		return models.User{}, models.ErrInvalidToken
+	if !p.IsUserInGroups(rule.Groups, user.Groups) {
+		p.logDenial(ctx,
+			"User isn't a member of needed groups",
+			p.userAttr(user),
+			slog.Any("user_groups", user.Groups),
+			slog.Any("needed_groups", rule.Groups),
+		)
+		return user, claims, &models.AuthError{Reason: models.ReasonMissingGroup, Required: rule.Groups}
 	}
 
-	user := models.User{
-		Roles:      claims.ResourceAccess.Client.Roles,
-		UserID:     claims.Subject,
-		Email:      claims.Email,
-		Username:   claims.PreferredUsername,
-		Name:       claims.Name,
-		FamilyName: claims.FamilyName,
+	if !p.IsPermissionGranted(ctx, rule.Permissions, claims, tokenString) {
+		p.logDenial(ctx,
+			"User doesn't have needed permissions",
+			p.userAttr(user),
+			slog.Any("user_permissions", claims.Authorization.Permissions),
+			slog.Any("needed_permissions", rule.Permissions),
+		)
+		required := make([]string, 0, len(rule.Permissions))
+		for _, permission := range rule.Permissions {
+			required = append(required, permission.String())
+		}
+		return user, claims, &models.AuthError{Reason: models.ReasonMissingPermission, Required: required}
 	}
 
-	neededRoles := p.secureEndpoints[path]
-	if len(neededRoles) == 0 {
-		neededRoles = []string{}
+	if !p.IsScopeSatisfied(rule.Scopes, rule.ScopeMatch, user.Scopes) {
+		p.logDenial(ctx,
+			"User doesn't have needed scopes",
+			p.userAttr(user),
+			slog.Any("user_scopes", user.Scopes),
+			slog.Any("needed_scopes", rule.Scopes),
+		)
+		return user, claims, &models.AuthError{
+			Reason:   models.ReasonInsufficientScope,
+			Required: rule.Scopes,
+			Err:      &models.ScopeError{Scopes: rule.Scopes},
+		}
 	}
-	if !p.IsUserHaveRoles(neededRoles, claims.ResourceAccess.Client.Roles) {
-		p.logger.Error("User data", slog.Any("User", user))
-		p.logger.Error(
-			"User doesn't have needed roles",
-			slog.Any("User roles", claims.ResourceAccess.Client.Roles),
-			slog.Any("Needed Roles", neededRoles),
+
+	if !p.IsACRSatisfied(rule.ACR, claims.Acr) || !p.IsAMRSatisfied(rule.AMR, claims.Amr) {
+		p.logDenial(ctx,
+			"User authentication level is insufficient",
+			p.userAttr(user),
+			slog.String("user_acr", claims.Acr),
+			slog.Any("user_amr", claims.Amr),
+			slog.String("needed_acr", rule.ACR),
+			slog.Any("needed_amr", rule.AMR),
 		)
-		return user, models.ErrAccessDenied
+		return user, claims, &models.AuthError{
+			Reason: models.ReasonInsufficientAuthentication,
+			Err:    &models.StepUpError{ACR: rule.ACR, AMR: rule.AMR},
+		}
+	}
+
+	if err = p.EvaluatePolicy(ctx, rule, user, claims, path, params); err != nil {
+		p.logDenial(ctx, "Access policy denied the request", p.userAttr(user), slog.String("err", err.Error()))
+		return user, claims, &models.AuthError{Reason: models.ReasonPolicyDenied, Err: err}
 	}
 
-	return user, nil
+	return user, claims, nil
 }
 
-// AuthorizeHTTP authorizes the user based on the passed token, HTTP method, and endpoint path.
-// Checks the validity of the token and whether the user has the necessary roles for access.
-// Parameters:
-// - method: HTTP method (e.g., "GET", "POST", "PUT", "DELETE").
-// - path: path of the protected endpoint (e.g., "/api/v1/user").
-// - tokenString: string with the user's JWT token.
-// Returns user and error (if any).
-func (p *Provider) AuthorizeHTTP(ctx context.Context, method, path, tokenString string) (models.User, error) {
+// Authenticate verifies the token and its binding to the request and builds the user from the claims.
+// The rule is only consulted for its token binding requirements; access rules aren't checked.
+// In case of an error, returns a *models.AuthError matching ErrInvalidToken or ErrInvalidDPoPProof.
+func (p *Provider) Authenticate(ctx context.Context, tokenString string, rule models.EndpointInfo) (models.User, *models.Claims, error) {
 	token, err := p.VerifyToken(ctx, tokenString)
 	if err != nil {
-		p.logger.Error("Failed to verify token", slog.String("err", err.Error()))
-		return models.User{}, models.ErrInvalidToken
+		p.logDenial(ctx, "Failed to verify token", slog.String("err", err.Error()))
+		return models.User{}, nil, err
 	}
 
 	claims, ok := token.Claims.(*models.Claims)
 	if !(ok && token.Valid) {
-		p.logger.Error("Failed to get claims from token")
-		return models.User{}, models.ErrInvalidToken
+		p.logDenial(ctx, "Failed to get claims from token")
+		return models.User{}, nil, &models.AuthError{Reason: models.ReasonInvalidClaims}
 	}
 
-	if claims.Subject == "" {
-		p.logger.Error("Failed to get sub claims from token")
-		return models.User{}, models.ErrInvalidToken
+	if err = p.VerifyBinding(ctx, claims, tokenString, rule); err != nil {
+		p.logDenial(ctx, "Failed to verify token binding", slog.String("err", err.Error()))
+		reason := models.ReasonInvalidBinding
+		if errors.Is(err, models.ErrInvalidDPoPProof) {
+			reason = models.ReasonInvalidDPoPProof
+		}
+		return models.User{}, nil, &models.AuthError{Reason: reason, Err: err}
 	}
 
-	if err = p.validate.Var(claims.Subject, "uuid4"); err != nil {
-		p.logger.Error("Failed to validate sub claim", slog.String("err", err.Error()))
-		return models.User{}, models.ErrInvalidToken
+	principalID := p.PrincipalID(claims)
+	if principalID == "" {
+		p.logDenial(ctx, "Failed to get principal claim from token", slog.String("claim", p.config.PrincipalClaim))
+		return models.User{}, nil, &models.AuthError{Reason: models.ReasonInvalidSubject}
+	}
+
+	if err = p.subjectValidator(principalID); err != nil {
+		p.logDenial(ctx, "Failed to validate principal claim", slog.String("err", err.Error()))
+		return models.User{}, nil, &models.AuthError{Reason: models.ReasonInvalidSubject, Err: err}
 	}
 
 	user := models.User{
+		Kind:       models.PrincipalUser,
+		Realm:      p.realmOf(claims.Issuer),
+		ClientID:   claims.CallingClient(),
 		Roles:      claims.ResourceAccess.Client.Roles,
-		UserID:     claims.Subject,
+		Groups:     claims.Groups,
+		Scopes:     claims.Scopes(),
+		UserID:     principalID,
 		Email:      claims.Email,
 		Username:   claims.PreferredUsername,
 		Name:       claims.Name,
 		FamilyName: claims.FamilyName,
 	}
 
-	key := fmt.Sprintf("%s:%s", method, path)
-	neededRoles := p.secureEndpoints[key]
-	if len(neededRoles) == 0 {
-		neededRoles = []string{}
+	if claims.IsServiceAccount() {
+		user.Kind = models.PrincipalServiceAccount
 	}
-	if !p.IsUserHaveRoles(neededRoles, claims.ResourceAccess.Client.Roles) {
-		p.logger.Error("User data", slog.Any("User", user))
-		p.logger.Error(
-			"User doesn't have needed roles",
-			slog.Any("User roles", claims.ResourceAccess.Client.Roles),
-			slog.Any("Needed Roles", neededRoles),
-		)
-		return user, models.ErrAccessDenied
+
+	if user.Attributes, err = p.MapClaims(claims); err != nil {
+		p.logDenial(ctx, "Failed to map claims", slog.String("err", err.Error()))
+		return models.User{}, nil, &models.AuthError{Reason: models.ReasonInvalidClaims, Err: err}
 	}
 
-	return user, nil
+	return user, claims, nil
 }
@@ -0,0 +1,99 @@
+package keyimpl
+
+import (
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// serviceAccountClaims returns the claims of a token obtained by the client with the client credentials grant.
+func serviceAccountClaims(clientID string) jwt.MapClaims {
+	claims := userClaims()
+	claims["azp"] = clientID
+	claims["client_id"] = clientID
+	claims["preferred_username"] = "service-account-" + clientID
+	return claims
+}
+
+func TestProvider_Authorize_Clients(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	spoofed := userClaims()
+	spoofed["azp"] = "web-app"
+	spoofed["preferred_username"] = "service-account-billing"
+
+	user := userClaims()
+	user["azp"] = "web-app"
+
+	test := []struct {
+		name   string
+		rule   models.EndpointInfo
+		claims jwt.MapClaims
+		kind   models.PrincipalKind
+		isFail bool
+	}{
+		{
+			name:   "Allowed client",
+			rule:   models.EndpointInfo{Clients: []string{"billing", "reporting"}},
+			claims: serviceAccountClaims("billing"),
+			kind:   models.PrincipalServiceAccount,
+		},
+		{
+			name:   "Denied client",
+			rule:   models.EndpointInfo{Clients: []string{"reporting"}},
+			claims: serviceAccountClaims("billing"),
+			isFail: true,
+		},
+		{
+			name:   "Service account on service account endpoint",
+			rule:   models.EndpointInfo{Principal: models.PrincipalServiceAccount},
+			claims: serviceAccountClaims("billing"),
+			kind:   models.PrincipalServiceAccount,
+		},
+		{
+			name:   "User on service account endpoint",
+			rule:   models.EndpointInfo{Principal: models.PrincipalServiceAccount},
+			claims: user,
+			isFail: true,
+		},
+		{
+			name:   "User named like a service account on service account endpoint",
+			rule:   models.EndpointInfo{Principal: models.PrincipalServiceAccount, Clients: []string{"billing"}},
+			claims: spoofed,
+			isFail: true,
+		},
+		{
+			name:   "User on user endpoint",
+			rule:   models.EndpointInfo{Principal: models.PrincipalUser, Clients: []string{"web-app"}},
+			claims: user,
+			kind:   models.PrincipalUser,
+		},
+		{
+			name:   "Service account on user endpoint",
+			rule:   models.EndpointInfo{Principal: models.PrincipalUser},
+			claims: serviceAccountClaims("billing"),
+			isFail: true,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewHTTPProvider(issuer.config(), newTestRedis(t))
+			tt.rule.Method, tt.rule.Path = "GET", "/api/invoices"
+			require.NoError(t, p.RegisterEndpoint(tt.rule))
+
+			user, err := p.AuthorizeHTTP(context.Background(), "GET", "/api/invoices", issuer.sign(t, tt.claims))
+			if tt.isFail {
+				require.ErrorIs(t, err, models.ErrAccessDenied)
+				assert.Equal(t, models.ReasonClientNotAllowed, models.ReasonOf(err))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.kind, user.Kind)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package keyimpl
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+)
+
+// Realm describes a trusted Keycloak realm of a multi-realm provider.
+type Realm struct {
+	// Name - name of the realm exposed in models.User. If not specified, it is taken from the issuer URI.
+	Name string `json:"name" yaml:"name"`
+
+	// Issuer - issuer URI of the realm, e.g. "http://localhost:8180/realms/customer-a".
+	// Tokens are routed to the realm by their iss claim.
+	Issuer string `json:"issuer" yaml:"issuer" validate:"required"`
+
+	// PublicJWKUri - URI to get the public JWK of the realm.
+	// If not specified, the Keycloak certificates endpoint of the issuer is used.
+	PublicJWKUri string `json:"public_jwk_uri" yaml:"public_jwk_uri"`
+
+	// ClientID - client identifier whose roles are read from the tokens of the realm.
+	// If not specified, Config.ClientID is used.
+	ClientID string `json:"client_id" yaml:"client_id"`
+}
+
+// newRealms indexes the configured realms by issuer and fills in their defaults.
+func newRealms(config *Config) map[string]Realm {
+	realms := make(map[string]Realm, len(config.Realms))
+	for _, realm := range config.Realms {
+		realm = completeRealm(realm, config.ClientID)
+		realms[realm.Issuer] = realm
+	}
+	return realms
+}
+
+// completeRealm fills in the defaults of the realm.
+func completeRealm(realm Realm, clientID string) Realm {
+	realm.Issuer = strings.TrimSuffix(realm.Issuer, "/")
+	if realm.Name == "" {
+		realm.Name = realmName(realm.Issuer)
+	}
+	if realm.PublicJWKUri == "" {
+		realm.PublicJWKUri = realm.Issuer + "/protocol/openid-connect/certs"
+	}
+	if realm.ClientID == "" {
+		realm.ClientID = clientID
+	}
+	return realm
+}
+
+// defaultRealm returns the realm of a single-realm provider, described by PublicJWKUri and ClientID.
+// Its issuer is left empty, so the iss claim isn't checked.
+func (p *Provider) defaultRealm() Realm {
+	return Realm{
+		Name:         realmName(p.config.IssuerURI),
+		PublicJWKUri: p.config.PublicJWKUri,
+		ClientID:     p.config.ClientID,
+	}
+}
+
+// TokenRealm selects the realm the token should be verified against by its unverified iss claim.
+// A provider without configured realms or tenant resolver always returns its default realm. Issuers that
+// aren't configured are passed to the tenant resolver, if any, and rejected otherwise;
+// the issuer is verified together with the signature afterwards.
+func (p *Provider) TokenRealm(ctx context.Context, tokenString string) (Realm, error) {
+	if len(p.realms) == 0 && p.tenantResolver == nil {
+		return p.defaultRealm(), nil
+	}
+
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &claims); err != nil {
+		return Realm{}, err
+	}
+
+	realm, ok := p.realms[strings.TrimSuffix(claims.Issuer, "/")]
+	if ok {
+		return realm, nil
+	}
+
+	if p.tenantResolver != nil {
+		return p.resolveRealm(ctx, claims.Issuer)
+	}
+
+	return Realm{}, fmt.Errorf("untrusted issuer %q", claims.Issuer)
+}
+
+// realmOf returns the name of the realm that issued a verified token.
+func (p *Provider) realmOf(issuer string) string {
+	issuer = strings.TrimSuffix(issuer, "/")
+	if realm, ok := p.realms[issuer]; ok {
+		return realm.Name
+	}
+	if realm, ok := p.realmCache.realm(issuer); ok {
+		return realm.Name
+	}
+	return realmName(issuer)
+}
+
+// realmName returns the realm name from a Keycloak issuer URI, e.g. "customer-a" for
+// "http://localhost:8180/realms/customer-a".
+func realmName(issuer string) string {
+	issuer = strings.TrimSuffix(issuer, "/")
+	if i := strings.LastIndex(issuer, "/realms/"); i >= 0 {
+		return issuer[i+len("/realms/"):]
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package keyimpl
+
+import (
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProvider_AuthorizeHTTP_Realms(t *testing.T) {
+	customerA := newTestIssuer(t)
+	customerB := newTestIssuer(t)
+
+	config := &Config{
+		ClientID:          "aibolit-api",
+		RefreshJWKTimeout: time.Hour,
+		PrincipalClaim:    "sub",
+		SubjectPolicy:     "uuid4",
+		Realms: []Realm{
+			{Issuer: "https://sso.example.com/realms/customer-a", PublicJWKUri: customerA.URL},
+			{Name: "b", Issuer: "https://sso.example.com/realms/customer-b/", PublicJWKUri: customerB.URL, ClientID: "portal"},
+		},
+	}
+	p := NewHTTPProvider(config, newTestRedis(t))
+	require.NoError(t, p.RegisterEndpoint(models.EndpointInfo{Method: http.MethodGet, Path: "/api/reports", Roles: []string{"user"}}))
+
+	claims := func(issuer, client string) jwt.MapClaims {
+		c := userClaims()
+		c["iss"] = issuer
+		c["resource_access"] = map[string]any{client: map[string]any{"roles": []string{"user"}}}
+		return c
+	}
+
+	user, err := p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports",
+		customerA.sign(t, claims("https://sso.example.com/realms/customer-a", "aibolit-api")))
+	require.NoError(t, err)
+	assert.Equal(t, "customer-a", user.Realm)
+
+	user, err = p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports",
+		customerB.sign(t, claims("https://sso.example.com/realms/customer-b", "portal")))
+	require.NoError(t, err)
+	assert.Equal(t, "b", user.Realm)
+
+	_, err = p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports",
+		customerB.sign(t, claims("https://sso.example.com/realms/customer-b", "aibolit-api")))
+	require.ErrorIs(t, err, models.ErrAccessDenied, "roles are read from the client of the realm")
+
+	_, err = p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports",
+		customerB.sign(t, claims("https://sso.example.com/realms/customer-a", "aibolit-api")))
+	require.ErrorIs(t, err, models.ErrInvalidToken, "token signed by another realm")
+
+	_, err = p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports",
+		customerA.sign(t, claims("https://evil.example.com/realms/customer-a", "aibolit-api")))
+	require.ErrorIs(t, err, models.ErrInvalidToken, "untrusted issuer")
+
+	realm, err := p.TokenRealm(context.Background(), customerA.sign(t, claims("https://sso.example.com/realms/customer-a", "aibolit-api")))
+	require.NoError(t, err)
+	assert.Equal(t, "https://sso.example.com/realms/customer-a/protocol/openid-connect/certs",
+		newRealms(&Config{Realms: []Realm{{Issuer: realm.Issuer}}})[realm.Issuer].PublicJWKUri)
+}
@@ -0,0 +1,125 @@
+package keyimpl
+
+import (
+	"container/list"
+	"github.com/lestrrat-go/jwx/jwk"
+	"sync"
+	"time"
+)
+
+// Defaults of the realm cache used when the configuration leaves them unset.
+const (
+	_defaultRealmCacheSize   = 100
+	_defaultRealmIdleTimeout = time.Hour
+)
+
+// realmCache is a bounded LRU of the realms in use and their JWK sets.
+// Realms that weren't used for the idle timeout are evicted.
+type realmCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+}
+
+// realmEntry is a cached realm with its JWK set.
+type realmEntry struct {
+	realm     Realm
+	keySet    jwk.Set
+	fetchedAt time.Time
+	usedAt    time.Time
+}
+
+// get returns the entry of the issuer and marks it as used.
+func (c *realmCache) get(issuer string, now time.Time, idle time.Duration) (realmEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictIdle(now, idle)
+	element, ok := c.entries[issuer]
+	if !ok {
+		return realmEntry{}, false
+	}
+
+	entry := element.Value.(*realmEntry)
+	entry.usedAt = now
+	c.order.MoveToFront(element)
+	return *entry, true
+}
+
+// put stores the entry, evicting the least recently used realms above the size.
+func (c *realmCache) put(entry realmEntry, size int, idle time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.order = list.New()
+	}
+
+	c.evictIdle(entry.usedAt, idle)
+	if element, ok := c.entries[entry.realm.Issuer]; ok {
+		element.Value = &entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[entry.realm.Issuer] = c.order.PushFront(&entry)
+	for c.order.Len() > size {
+		c.remove(c.order.Back())
+	}
+}
+
+// realm returns the cached realm of the issuer without marking it as used.
+func (c *realmCache) realm(issuer string) (Realm, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[issuer]
+	if !ok {
+		return Realm{}, false
+	}
+	return element.Value.(*realmEntry).realm, true
+}
+
+// len returns the number of cached realms.
+func (c *realmCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// evictIdle removes the realms that weren't used since now minus idle. Must be called with mu held.
+func (c *realmCache) evictIdle(now time.Time, idle time.Duration) {
+	if c.order == nil {
+		return
+	}
+	for element := c.order.Back(); element != nil; element = c.order.Back() {
+		if now.Sub(element.Value.(*realmEntry).usedAt) < idle {
+			return
+		}
+		c.remove(element)
+	}
+}
+
+// remove removes the element. Must be called with mu held.
+func (c *realmCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*realmEntry).realm.Issuer)
+}
+
+// realmCacheSize returns the configured realm cache size or the default of 100 realms.
+func (p *Provider) realmCacheSize() int {
+	if p.config.RealmCacheSize > 0 {
+		return p.config.RealmCacheSize
+	}
+	return _defaultRealmCacheSize
+}
+
+// realmIdleTimeout returns the configured realm idle timeout or the default of 1 hour.
+func (p *Provider) realmIdleTimeout() time.Duration {
+	if p.config.RealmIdleTimeout > 0 {
+		return p.config.RealmIdleTimeout
+	}
+	return _defaultRealmIdleTimeout
+}
@@ -0,0 +1,53 @@
+package keyimpl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"time"
+)
+
+// Redis key prefix of the revoked token identifiers
+const _revokedJTIPrefix = "revoked-jti:"
+
+// errTokenRevoked is returned by verifyToken for tokens whose jti was revoked with RevokeToken.
+var errTokenRevoked = fmt.Errorf("%w: token was revoked", models.ErrInvalidToken)
+
+// RevokeToken adds the token identifier (jti claim) to the denylist in Redis, so the token is rejected with
+// models.ReasonRevoked until it expires, e.g. after a logout or a back-channel logout from Keycloak.
+// The denylist is consulted only when Config.CheckRevocation is set.
+//
+// Example:
+//
+//	err := authProvider.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time)
+func (p *Provider) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return errors.New("token has no jti")
+	}
+
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return p.redis.Set(ctx, _revokedJTIPrefix+jti, 1, ttl).Err()
+}
+
+// checkRevocation returns errTokenRevoked if the token identifier is on the denylist.
+// Tokens without a jti can't be revoked. The token is rejected if the denylist can't be read.
+func (p *Provider) checkRevocation(ctx context.Context, claims *models.Claims) error {
+	if !p.config.CheckRevocation || claims.ID == "" {
+		return nil
+	}
+
+	revoked, err := p.redis.Exists(ctx, _revokedJTIPrefix+claims.ID).Result()
+	if err != nil {
+		return fmt.Errorf("%w: cannot check revocation: %v", models.ErrInvalidToken, err)
+	}
+	if revoked > 0 {
+		return errTokenRevoked
+	}
+
+	return nil
+}
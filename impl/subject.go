@@ -0,0 +1,82 @@
+package keyimpl
+
+import (
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"log/slog"
+	"regexp"
+)
+
+// Supported values of Config.SubjectPolicy.
+const (
+	// SubjectPolicyUUID4 requires the user ID to be a UUID version 4. This is the default.
+	SubjectPolicyUUID4 = "uuid4"
+
+	// SubjectPolicyUUID requires the user ID to be a UUID of any version.
+	SubjectPolicyUUID = "uuid"
+
+	// SubjectPolicyRegex requires the user ID to match Config.SubjectPattern.
+	SubjectPolicyRegex = "regex"
+
+	// SubjectPolicyNone accepts any non-empty user ID.
+	SubjectPolicyNone = "none"
+)
+
+// SubjectValidator validates the user ID taken from the token. A non-nil error rejects the token.
+type SubjectValidator func(subject string) error
+
+// newSubjectValidator builds the SubjectValidator described by the configuration.
+// An invalid configuration produces a validator that rejects every token.
+func (p *Provider) newSubjectValidator() SubjectValidator {
+	switch p.config.SubjectPolicy {
+	case "", SubjectPolicyUUID4:
+		return func(subject string) error {
+			return p.validate.Var(subject, "uuid4")
+		}
+	case SubjectPolicyUUID:
+		return func(subject string) error {
+			return p.validate.Var(subject, "uuid")
+		}
+	case SubjectPolicyRegex:
+		pattern, err := regexp.Compile(p.config.SubjectPattern)
+		if err != nil {
+			return p.invalidSubjectPolicy(fmt.Errorf("invalid subject pattern: %w", err))
+		}
+		return func(subject string) error {
+			if !pattern.MatchString(subject) {
+				return fmt.Errorf("subject doesn't match pattern %q", pattern)
+			}
+			return nil
+		}
+	case SubjectPolicyNone:
+		return func(string) error {
+			return nil
+		}
+	default:
+		return p.invalidSubjectPolicy(fmt.Errorf("unknown subject policy %q", p.config.SubjectPolicy))
+	}
+}
+
+// invalidSubjectPolicy logs the configuration error and returns a validator that always fails with it.
+func (p *Provider) invalidSubjectPolicy(err error) SubjectValidator {
+	p.logger.Error("Invalid subject policy, all tokens will be rejected", slog.String("err", err.Error()))
+	return func(string) error {
+		return err
+	}
+}
+
+// PrincipalID returns the user ID from the claim configured in Config.PrincipalClaim.
+// Returns an empty string if the claim is missing or isn't a string.
+func (p *Provider) PrincipalID(claims *models.Claims) string {
+	if p.config.PrincipalClaim == "" || p.config.PrincipalClaim == "sub" {
+		return claims.Subject
+	}
+
+	value, ok := claims.Lookup(p.config.PrincipalClaim)
+	if !ok {
+		return ""
+	}
+
+	principal, _ := value.(string)
+	return principal
+}
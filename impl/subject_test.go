@@ -0,0 +1,87 @@
+package keyimpl
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestProvider_SubjectValidator(t *testing.T) {
+	const (
+		uuid4 = "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60"
+		uuid1 = "c232ab00-9414-11ec-b3c8-9e6bdeced846"
+	)
+
+	test := []struct {
+		name    string
+		config  Config
+		subject string
+		isFail  bool
+	}{
+		{name: "Default accepts uuid4", config: Config{}, subject: uuid4},
+		{name: "Default rejects uuid1", config: Config{}, subject: uuid1, isFail: true},
+		{name: "Any uuid accepts uuid1", config: Config{SubjectPolicy: SubjectPolicyUUID}, subject: uuid1},
+		{name: "Any uuid rejects username", config: Config{SubjectPolicy: SubjectPolicyUUID}, subject: "jdoe", isFail: true},
+		{name: "Regex match", config: Config{SubjectPolicy: SubjectPolicyRegex, SubjectPattern: `^f:[a-z0-9-]+:\w+$`}, subject: "f:ldap-1:jdoe"},
+		{name: "Regex mismatch", config: Config{SubjectPolicy: SubjectPolicyRegex, SubjectPattern: `^f:[a-z0-9-]+:\w+$`}, subject: uuid4, isFail: true},
+		{name: "Invalid regex rejects everything", config: Config{SubjectPolicy: SubjectPolicyRegex, SubjectPattern: `(`}, subject: uuid4, isFail: true},
+		{name: "None accepts anything", config: Config{SubjectPolicy: SubjectPolicyNone}, subject: "service-account-billing"},
+		{name: "Unknown policy rejects everything", config: Config{SubjectPolicy: "ulid"}, subject: uuid4, isFail: true},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewGRPCProvider(&tt.config, nil)
+
+			err := p.subjectValidator(tt.subject)
+			if tt.isFail {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestProvider_WithSubjectValidator(t *testing.T) {
+	errRejected := errors.New("rejected")
+	p := NewGRPCProvider(&Config{}, nil, WithSubjectValidator(func(string) error {
+		return errRejected
+	}))
+
+	assert.ErrorIs(t, p.subjectValidator("1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60"), errRejected)
+}
+
+func TestProvider_PrincipalID(t *testing.T) {
+	var claims models.Claims
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"sub": "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60",
+		"preferred_username": "service-account-billing",
+		"client_id": "billing",
+		"employee_number": 4711
+	}`), &claims))
+
+	test := []struct {
+		claim    string
+		expected string
+	}{
+		{claim: "", expected: "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60"},
+		{claim: "sub", expected: "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60"},
+		{claim: "preferred_username", expected: "service-account-billing"},
+		{claim: "client_id", expected: "billing"},
+		{claim: "employee_number", expected: ""},
+		{claim: "missing", expected: ""},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.claim, func(t *testing.T) {
+			p := NewGRPCProvider(&Config{PrincipalClaim: tt.claim}, nil)
+
+			assert.Equal(t, tt.expected, p.PrincipalID(&claims))
+		})
+	}
+}
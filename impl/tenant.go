@@ -0,0 +1,138 @@
+package keyimpl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// TenantResolver maps the incoming request and the unverified iss claim of the token to the realm the token
+// must be verified against. It's consulted for tokens of issuers that aren't among the configured Realms.
+//
+// Resolved realms must satisfy Config.IssuerPattern, and the token must have been issued by the resolved realm.
+type TenantResolver func(ctx context.Context, request models.RequestInfo, issuer string) (Realm, error)
+
+// ErrUnknownTenant is returned by resolvers that can't find the tenant of the request.
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// tenantPattern restricts tenant names substituted into issuer templates.
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// IssuerTenantResolver resolves the realm from the token's iss claim itself.
+// Config.IssuerPattern is what keeps forged issuers out, so it must be as strict as possible, e.g.
+// "https://sso\.example\.com/realms/[a-z0-9-]+".
+func IssuerTenantResolver() TenantResolver {
+	return func(_ context.Context, _ models.RequestInfo, issuer string) (Realm, error) {
+		return Realm{Issuer: issuer}, nil
+	}
+}
+
+// HostTenantResolver resolves the tenant from the first label of the request host, e.g. "acme" for
+// "acme.api.example.com", and substitutes it for "{tenant}" in the issuer template.
+// The host is taken from RequestInfo.URL, the ":authority" gRPC pseudo-header or the Host header.
+func HostTenantResolver(issuerTemplate string) TenantResolver {
+	return templateResolver(issuerTemplate, func(request models.RequestInfo) string {
+		host, _, _ := strings.Cut(requestHost(request), ".")
+		return host
+	})
+}
+
+// PathTenantResolver resolves the tenant from the first segment of the request path, e.g. "acme" for
+// "/acme/api/users", and substitutes it for "{tenant}" in the issuer template.
+func PathTenantResolver(issuerTemplate string) TenantResolver {
+	return templateResolver(issuerTemplate, func(request models.RequestInfo) string {
+		tenant, _, _ := strings.Cut(strings.TrimPrefix(request.Path, "/"), "/")
+		return tenant
+	})
+}
+
+// HeaderTenantResolver resolves the tenant from the request header or gRPC metadata key, e.g. "x-tenant-id",
+// and substitutes it for "{tenant}" in the issuer template.
+func HeaderTenantResolver(key, issuerTemplate string) TenantResolver {
+	return templateResolver(issuerTemplate, func(request models.RequestInfo) string {
+		return request.Headers.Get(key)
+	})
+}
+
+// templateResolver returns a resolver substituting the tenant extracted from the request into the issuer template.
+func templateResolver(issuerTemplate string, tenant func(request models.RequestInfo) string) TenantResolver {
+	return func(_ context.Context, request models.RequestInfo, _ string) (Realm, error) {
+		name := tenant(request)
+		if !tenantPattern.MatchString(name) {
+			return Realm{}, ErrUnknownTenant
+		}
+		return Realm{Issuer: strings.ReplaceAll(issuerTemplate, "{tenant}", name)}, nil
+	}
+}
+
+// requestHost returns the host of the request without port.
+func requestHost(request models.RequestInfo) string {
+	var host string
+	if u, err := url.Parse(request.URL); err == nil && u.Host != "" {
+		host = u.Host
+	} else if authority := request.Headers.Get(":authority"); authority != "" {
+		host = authority
+	} else {
+		host = request.Headers.Get("Host")
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// initIssuerPattern compiles Config.IssuerPattern anchored to the whole issuer.
+// Without a valid pattern, no resolved realm is trusted.
+func (p *Provider) initIssuerPattern() {
+	if p.config.IssuerPattern == "" {
+		return
+	}
+
+	pattern, err := regexp.Compile("^(?:" + p.config.IssuerPattern + ")$")
+	if err != nil {
+		p.logger.Error("Invalid issuer pattern, resolved realms are rejected", slog.String("err", err.Error()))
+		return
+	}
+	p.issuerPattern = pattern
+}
+
+// resolveRealm resolves the realm of a token whose issuer isn't configured statically.
+func (p *Provider) resolveRealm(ctx context.Context, issuer string) (Realm, error) {
+	if p.issuerPattern == nil {
+		return Realm{}, fmt.Errorf("issuer pattern isn't configured, resolved realms aren't trusted")
+	}
+
+	request, _ := ctx.Value(provider.RequestInfoKey).(models.RequestInfo)
+	resolved, err := p.tenantResolver(ctx, request, issuer)
+	if err != nil {
+		return Realm{}, err
+	}
+
+	realm := completeRealm(resolved, p.config.ClientID)
+	if !p.issuerPattern.MatchString(realm.Issuer) {
+		return Realm{}, fmt.Errorf("issuer %q isn't allowed", realm.Issuer)
+	}
+	if realm.Issuer != strings.TrimSuffix(issuer, "/") {
+		return Realm{}, fmt.Errorf("token issuer %q doesn't match the tenant realm %q", issuer, realm.Issuer)
+	}
+	if resolved.PublicJWKUri == "" {
+		return realm, nil
+	}
+
+	// An explicit JWK URI must be served by the issuer, so a resolver can't be tricked into fetching other hosts.
+	jwkURI, err := url.Parse(realm.PublicJWKUri)
+	issuerURI, _ := url.Parse(realm.Issuer)
+	if err != nil || issuerURI == nil || jwkURI.Scheme != issuerURI.Scheme || jwkURI.Host != issuerURI.Host {
+		return Realm{}, fmt.Errorf("jwk uri %q isn't served by the issuer %q", realm.PublicJWKUri, realm.Issuer)
+	}
+
+	return realm, nil
+}
@@ -0,0 +1,103 @@
+package keyimpl
+
+import (
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestProvider_AuthorizeHTTP_TenantResolver(t *testing.T) {
+	issuer := newTestIssuer(t)
+	acme := issuer.URL + "/realms/acme"
+
+	config := issuer.config()
+	config.PrincipalClaim = "sub"
+	config.SubjectPolicy = "uuid4"
+	config.IssuerPattern = regexp.QuoteMeta(issuer.URL) + "/realms/[a-z0-9-]+"
+	p := NewHTTPProvider(config, newTestRedis(t), WithTenantResolver(HostTenantResolver(issuer.URL+"/realms/{tenant}")))
+
+	claims := func(iss string) jwt.MapClaims {
+		c := userClaims()
+		c["iss"] = iss
+		return c
+	}
+	requestTo := func(host string) context.Context {
+		return context.WithValue(context.Background(), provider.RequestInfoKey,
+			models.RequestInfo{Method: http.MethodGet, URL: "https://" + host + "/api/reports"})
+	}
+
+	user, err := p.AuthorizeHTTP(requestTo("acme.api.example.com"), http.MethodGet, "/api/reports", issuer.sign(t, claims(acme)))
+	require.NoError(t, err)
+	assert.Equal(t, "acme", user.Realm)
+	assert.Equal(t, 1, p.realmCache.len())
+
+	_, err = p.AuthorizeHTTP(requestTo("globex.api.example.com"), http.MethodGet, "/api/reports", issuer.sign(t, claims(acme)))
+	require.ErrorIs(t, err, models.ErrInvalidToken, "token of another tenant")
+
+	_, err = p.AuthorizeHTTP(requestTo("Evil_.api.example.com:443"), http.MethodGet, "/api/reports", issuer.sign(t, claims(acme)))
+	require.ErrorIs(t, err, models.ErrInvalidToken, "tenant doesn't match the issuer")
+
+	forged := NewHTTPProvider(config, newTestRedis(t), WithTenantResolver(IssuerTenantResolver()))
+	_, err = forged.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports",
+		issuer.sign(t, claims("https://evil.example.com/realms/acme")))
+	require.ErrorIs(t, err, models.ErrInvalidToken, "issuer outside of the allow-list")
+	assert.Equal(t, 0, forged.realmCache.len())
+
+	config.IssuerPattern = ""
+	untrusted := NewHTTPProvider(config, newTestRedis(t), WithTenantResolver(IssuerTenantResolver()))
+	_, err = untrusted.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports", issuer.sign(t, claims(acme)))
+	require.ErrorIs(t, err, models.ErrInvalidToken, "no allow-list")
+}
+
+func TestTenantResolvers(t *testing.T) {
+	request := models.RequestInfo{
+		Path:    "/acme/api/users",
+		Headers: http.Header{":authority": {"globex.grpc.example.com:8443"}, "X-Tenant-Id": {"initech"}},
+	}
+
+	for name, tt := range map[string]struct {
+		resolver TenantResolver
+		want     string
+	}{
+		"Host from gRPC authority": {HostTenantResolver("https://sso/realms/{tenant}"), "https://sso/realms/globex"},
+		"Path prefix":              {PathTenantResolver("https://sso/realms/{tenant}"), "https://sso/realms/acme"},
+		"Metadata key":             {HeaderTenantResolver("x-tenant-id", "https://sso/realms/{tenant}"), "https://sso/realms/initech"},
+		"Issuer":                   {IssuerTenantResolver(), "https://sso/realms/hooli"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			realm, err := tt.resolver(context.Background(), request, "https://sso/realms/hooli")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, realm.Issuer)
+		})
+	}
+
+	_, err := HeaderTenantResolver("x-tenant-id", "https://sso/realms/{tenant}")(context.Background(),
+		models.RequestInfo{Headers: http.Header{"X-Tenant-Id": {"../master"}}}, "")
+	require.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestRealmCache(t *testing.T) {
+	var cache realmCache
+	now := time.Now()
+
+	for i, issuer := range []string{"a", "b", "c"} {
+		usedAt := now.Add(time.Duration(i) * time.Minute)
+		cache.put(realmEntry{realm: Realm{Issuer: issuer}, usedAt: usedAt}, 2, time.Hour)
+	}
+	_, ok := cache.get("a", now.Add(3*time.Minute), time.Hour)
+	assert.False(t, ok, "least recently used realm is evicted")
+
+	_, ok = cache.get("b", now.Add(4*time.Minute), time.Hour)
+	require.True(t, ok)
+
+	_, ok = cache.get("c", now.Add(2*time.Minute+time.Hour), time.Hour)
+	assert.False(t, ok, "idle realm is evicted")
+	assert.Equal(t, 1, cache.len())
+}
@@ -3,32 +3,120 @@ package keyimpl
 import (
 	"context"
 	"crypto/rsa"
+	"errors"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
 	"github.com/YATAHAKI/KeycloakAuth/models"
 	"github.com/golang-jwt/jwt/v5"
 	"log/slog"
+	"time"
+)
+
+// Errors of token verification steps, used to classify failures.
+var (
+	errTokenDecryption = errors.New("token decryption failed")
+	errUntrustedRealm  = errors.New("untrusted realm")
+	errUnknownKeyID    = fmt.Errorf("%w: unknown key id", models.ErrInvalidToken)
 )
 
 // VerifyToken verifies the JWT token passed as a string and returns its parsed structure if the token is valid.
-// In case of an error, returns an ErrInvalidToken error.
+// Encrypted tokens (JWE) are decrypted with the configured decryption keys first, and the nested token is verified.
+// In case of an error, returns a *models.AuthError with the reason of the failure and the underlying error,
+// which matches ErrInvalidToken.
 func (p *Provider) VerifyToken(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	ctx, span := p.tracer.Start(ctx, "keycloak.VerifyToken")
+	start := time.Now()
+	token, err := p.verifyToken(ctx, tokenString)
+	if err != nil {
+		reason := verificationReason(err)
+		p.metrics.TokenVerified(keymetrics.OutcomeFailure, string(reason), time.Since(start))
+		endSpan(span, err, string(reason))
+		return nil, &models.AuthError{Reason: reason, Err: err}
+	}
+
+	p.metrics.TokenVerified(keymetrics.OutcomeSuccess, "", time.Since(start))
+	endSpan(span, nil, "")
+	return token, nil
+}
+
+// verifyToken verifies the token and returns the underlying error of the failed step.
+func (p *Provider) verifyToken(ctx context.Context, tokenString string) (*jwt.Token, error) {
+	if IsEncryptedToken(tokenString) {
+		decrypted, err := p.DecryptToken(ctx, tokenString)
+		if err != nil {
+			p.logDenial(ctx, "Failed to decrypt token", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%w: %w", errTokenDecryption, err)
+		}
+		tokenString = decrypted
+	}
+
+	realm, err := p.TokenRealm(ctx, tokenString)
+	if err != nil {
+		p.logDenial(ctx, "Failed to select token realm", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%w: %w", errUntrustedRealm, err)
+	}
+
+	var parserOpts []jwt.ParserOption
+	if p.config.VerifyAudience {
+		parserOpts = append(parserOpts, jwt.WithAudience(realm.ClientID))
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &models.Claims{ResourceAccess: models.ResourceAccess{
-		ClientID: p.config.ClientID,
-	}}, p.KeyFunc(ctx))
+		ClientID: realm.ClientID,
+	}}, p.RealmKeyFunc(ctx, realm), parserOpts...)
 	if err != nil {
-		p.logger.Error("Failed to parse token", slog.String("error", err.Error()))
-		return nil, models.ErrInvalidToken
+		p.logDenial(ctx, "Failed to parse token", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	if err = p.checkRevocation(ctx, token.Claims.(*models.Claims)); err != nil {
+		p.logDenial(ctx, "Token revocation check failed", slog.String("error", err.Error()))
+		return nil, err
 	}
 
 	return token, nil
 }
 
+// verificationReason classifies the token verification error.
+func verificationReason(err error) models.Reason {
+	switch {
+	case errors.Is(err, errTokenDecryption):
+		return models.ReasonDecryptionFailed
+	case errors.Is(err, errUntrustedRealm), errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return models.ReasonWrongIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return models.ReasonWrongAudience
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return models.ReasonMalformed
+	case errors.Is(err, errTokenRevoked):
+		return models.ReasonRevoked
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return models.ReasonExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return models.ReasonNotYetValid
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return models.ReasonBadSignature
+	case errors.Is(err, models.ErrUnexpectedSigningMethod):
+		return models.ReasonUnexpectedSigningMethod
+	case errors.Is(err, errUnknownKeyID), errors.Is(err, models.ErrValidationToken):
+		return models.ReasonUnknownKeyID
+	default:
+		return models.ReasonInvalidToken
+	}
+}
+
 // KeyFunc returns a function that is used to retrieve the public key for token signature verification.
 // This function gets the JWK Set, retrieves the key by ID and returns it for verification.
 func (p *Provider) KeyFunc(ctx context.Context) jwt.Keyfunc {
+	return p.RealmKeyFunc(ctx, p.defaultRealm())
+}
+
+// RealmKeyFunc is like KeyFunc, but retrieves the public key from the JWK Set of the realm.
+func (p *Provider) RealmKeyFunc(ctx context.Context, realm Realm) jwt.Keyfunc {
 	return func(token *jwt.Token) (interface{}, error) {
-		var rawKey *rsa.PublicKey
+		var rawKey rsa.PublicKey
 
-		keySet, err := p.FetchJWKSet(ctx)
+		keySet, err := p.FetchRealmJWKSet(ctx, realm)
 		if err != nil {
 			p.logger.Error("Failed to fetch JWK Set", slog.String("err", err.Error()))
 			return nil, err
@@ -45,10 +133,10 @@ func (p *Provider) KeyFunc(ctx context.Context) jwt.Keyfunc {
 
 		key, found := keySet.LookupKeyID(keyID)
 		if !found {
-			return nil, models.ErrInvalidToken
+			return nil, errUnknownKeyID
 		}
 
-		if err = key.Raw(rawKey); err != nil {
+		if err = key.Raw(&rawKey); err != nil {
 			p.logger.Error("Failed to get raw key", slog.String("err", err.Error()))
 			return nil, models.ErrInvalidToken
 		}
@@ -0,0 +1,266 @@
+package keyimpl
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwe"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testIssuer is a local stand-in for a Keycloak realm signing tokens and serving its JWK set.
+type testIssuer struct {
+	*httptest.Server
+
+	key *rsa.PrivateKey
+	kid string
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	issuer := &testIssuer{key: key, kid: "realm-key"}
+
+	publicKey, err := jwk.New(&key.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, publicKey.Set(jwk.KeyIDKey, issuer.kid))
+	require.NoError(t, publicKey.Set(jwk.AlgorithmKey, jwa.RS256))
+	keySet := jwk.NewSet()
+	keySet.Add(publicKey)
+
+	issuer.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(keySet)
+	}))
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// sign creates a signed access token with the claims.
+func (i *testIssuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = i.kid
+
+	signed, err := token.SignedString(i.key)
+	require.NoError(t, err)
+	return signed
+}
+
+// config returns the provider configuration trusting the issuer.
+func (i *testIssuer) config() *Config {
+	return &Config{PublicJWKUri: i.URL, ClientID: "aibolit-api", RefreshJWKTimeout: time.Hour}
+}
+
+// userClaims returns the claims of a regular user token.
+func userClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":                "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "jdoe",
+		"resource_access":    map[string]any{"aibolit-api": map[string]any{"roles": []string{"user"}}},
+	}
+}
+
+func TestProvider_VerifyToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := NewHTTPProvider(issuer.config(), newTestRedis(t))
+
+	token, err := p.VerifyToken(context.Background(), issuer.sign(t, userClaims()))
+	require.NoError(t, err)
+
+	claims := token.Claims.(*models.Claims)
+	assert.Equal(t, "jdoe", claims.PreferredUsername)
+	assert.Equal(t, []string{"user"}, claims.ResourceAccess.Client.Roles)
+
+	expired := userClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = p.VerifyToken(context.Background(), issuer.sign(t, expired))
+	require.ErrorIs(t, err, models.ErrInvalidToken)
+}
+
+func TestProvider_VerifyToken_Audience(t *testing.T) {
+	issuer := newTestIssuer(t)
+	config := issuer.config()
+	config.VerifyAudience = true
+	p := NewHTTPProvider(config, newTestRedis(t))
+
+	claims := userClaims()
+	claims["aud"] = []string{"account", "aibolit-api"}
+	_, err := p.VerifyToken(context.Background(), issuer.sign(t, claims))
+	require.NoError(t, err)
+
+	claims["aud"] = "account"
+	_, err = p.VerifyToken(context.Background(), issuer.sign(t, claims))
+	require.ErrorIs(t, err, models.ErrInvalidToken)
+	assert.Equal(t, models.ReasonWrongAudience, models.ReasonOf(err))
+
+	_, err = NewHTTPProvider(issuer.config(), newTestRedis(t)).VerifyToken(context.Background(), issuer.sign(t, claims))
+	assert.NoError(t, err, "audience isn't checked by default")
+}
+
+func TestProvider_VerifyToken_Revoked(t *testing.T) {
+	issuer := newTestIssuer(t)
+	config := issuer.config()
+	config.CheckRevocation = true
+	p := NewHTTPProvider(config, newTestRedis(t))
+	ctx := context.Background()
+
+	claims := userClaims()
+	claims["jti"] = "3f0c8a52-9d1e-4b7a-8c2f-6e5d4a3b2c1d"
+	tokenString := issuer.sign(t, claims)
+
+	_, err := p.VerifyToken(ctx, tokenString)
+	require.NoError(t, err)
+
+	require.NoError(t, p.RevokeToken(ctx, "3f0c8a52-9d1e-4b7a-8c2f-6e5d4a3b2c1d", time.Now().Add(time.Hour)))
+	_, err = p.VerifyToken(ctx, tokenString)
+	require.ErrorIs(t, err, models.ErrInvalidToken)
+	assert.Equal(t, models.ReasonRevoked, models.ReasonOf(err))
+
+	config.CheckRevocation = false
+	_, err = p.VerifyToken(ctx, tokenString)
+	assert.NoError(t, err, "denylist isn't consulted by default")
+}
+
+// TestProvider_KeyFunc guards against passing a nil *rsa.PublicKey to key.Raw, which made every
+// RSA signature verification fail.
+func TestProvider_KeyFunc(t *testing.T) {
+	issuer := newTestIssuer(t)
+	p := NewHTTPProvider(issuer.config(), newTestRedis(t))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, userClaims())
+	token.Header["kid"] = issuer.kid
+
+	key, err := p.KeyFunc(context.Background())(token)
+	require.NoError(t, err)
+	require.IsType(t, &rsa.PublicKey{}, key)
+	assert.True(t, issuer.key.PublicKey.Equal(key))
+}
+
+func TestProvider_VerifyToken_Encrypted(t *testing.T) {
+	issuer := newTestIssuer(t)
+	signed := issuer.sign(t, userClaims())
+
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	currentKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keySet := jwk.NewSet()
+	for kid, key := range map[string]*rsa.PrivateKey{"enc-2023": oldKey, "enc-2024": currentKey} {
+		privateKey, err := jwk.New(key)
+		require.NoError(t, err)
+		require.NoError(t, privateKey.Set(jwk.KeyIDKey, kid))
+		keySet.Add(privateKey)
+	}
+	serialized, err := json.Marshal(keySet)
+	require.NoError(t, err)
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(keysFile, serialized, 0o600))
+
+	encryptWith := func(alg jwa.KeyEncryptionAlgorithm, key *rsa.PrivateKey, kid string) string {
+		headers := jwe.NewHeaders()
+		require.NoError(t, headers.Set(jwe.ContentTypeKey, "JWT"))
+		if kid != "" {
+			require.NoError(t, headers.Set(jwe.KeyIDKey, kid))
+		}
+		encrypted, err := jwe.Encrypt([]byte(signed), alg, &key.PublicKey, jwa.A256GCM, jwa.NoCompress,
+			jwe.WithProtectedHeaders(headers))
+		require.NoError(t, err)
+		return string(encrypted)
+	}
+	encrypt := func(key *rsa.PrivateKey, kid string) string {
+		return encryptWith(jwa.RSA_OAEP_256, key, kid)
+	}
+
+	t.Run("Key selected by kid from file", func(t *testing.T) {
+		config := issuer.config()
+		config.DecryptionKeysFile = keysFile
+		p := NewHTTPProvider(config, newTestRedis(t))
+
+		for _, tokenString := range []string{encrypt(oldKey, "enc-2023"), encrypt(currentKey, "enc-2024")} {
+			require.True(t, IsEncryptedToken(tokenString))
+			token, err := p.VerifyToken(context.Background(), tokenString)
+			require.NoError(t, err)
+			assert.Equal(t, "jdoe", token.Claims.(*models.Claims).PreferredUsername)
+		}
+	})
+
+	t.Run("PEM key without kid", func(t *testing.T) {
+		config := issuer.config()
+		config.DecryptionKeys = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(currentKey),
+		}))
+		p := NewHTTPProvider(config, newTestRedis(t))
+
+		_, err := p.VerifyToken(context.Background(), encrypt(currentKey, ""))
+		require.NoError(t, err)
+	})
+
+	t.Run("Unknown key", func(t *testing.T) {
+		config := issuer.config()
+		config.DecryptionKeysFile = keysFile
+		p := NewHTTPProvider(config, newTestRedis(t))
+
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		_, err = p.VerifyToken(context.Background(), encrypt(otherKey, "enc-2025"))
+		require.ErrorIs(t, err, models.ErrInvalidToken)
+	})
+
+	t.Run("Algorithm not allowed", func(t *testing.T) {
+		config := issuer.config()
+		config.DecryptionKeysFile = keysFile
+		p := NewHTTPProvider(config, newTestRedis(t))
+
+		_, err := p.VerifyToken(context.Background(), encryptWith(jwa.RSA1_5, currentKey, "enc-2024"))
+		require.ErrorIs(t, err, models.ErrInvalidToken)
+		assert.Equal(t, models.ReasonDecryptionFailed, models.ReasonOf(err))
+
+		config.DecryptionAlgorithms = []string{string(jwa.RSA_OAEP)}
+		p = NewHTTPProvider(config, newTestRedis(t))
+
+		_, err = p.VerifyToken(context.Background(), encrypt(currentKey, "enc-2024"))
+		assert.Equal(t, models.ReasonDecryptionFailed, models.ReasonOf(err))
+		_, err = p.VerifyToken(context.Background(), encryptWith(jwa.RSA_OAEP, currentKey, "enc-2024"))
+		require.NoError(t, err)
+	})
+
+	t.Run("Malformed keys file", func(t *testing.T) {
+		malformed := filepath.Join(t.TempDir(), "keys.json")
+		require.NoError(t, os.WriteFile(malformed, []byte("{not json"), 0o600))
+
+		var logs bytes.Buffer
+		config := issuer.config()
+		config.DecryptionKeysFile = malformed
+		p := NewHTTPProvider(config, newTestRedis(t), WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+
+		assert.Contains(t, logs.String(), "Failed to load decryption keys")
+		_, err := p.VerifyToken(context.Background(), encrypt(currentKey, "enc-2024"))
+		assert.Equal(t, models.ReasonDecryptionFailed, models.ReasonOf(err))
+	})
+
+	t.Run("No decryption keys", func(t *testing.T) {
+		p := NewHTTPProvider(issuer.config(), newTestRedis(t))
+
+		_, err := p.VerifyToken(context.Background(), encrypt(currentKey, "enc-2024"))
+		require.ErrorIs(t, err, models.ErrInvalidToken)
+	})
+}
@@ -0,0 +1,58 @@
+package keyimpl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer creating the spans of the provider
+const _tracerName = "github.com/YATAHAKI/KeycloakAuth"
+
+// Attributes of the spans of the provider.
+const (
+	attrEndpoint      = attribute.Key("auth.endpoint")
+	attrTransport     = attribute.Key("auth.transport")
+	attrDecision      = attribute.Key("auth.decision")
+	attrFailureReason = attribute.Key("auth.failure_reason")
+	attrSubjectHash   = attribute.Key("auth.subject_hash")
+	attrIssuer        = attribute.Key("auth.issuer")
+	attrJWKSSource    = attribute.Key("auth.jwks.source")
+	attrCached        = attribute.Key("auth.cached")
+	attrGranted       = attribute.Key("auth.permission_granted")
+)
+
+// defaultTracer returns the tracer of the global tracer provider, so spans are exported
+// once the application installs its provider.
+func defaultTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(_tracerName)
+}
+
+// endSpan ends the span, marking it as failed with the reason if err isn't nil.
+func endSpan(span trace.Span, err error, reason string) {
+	if err != nil {
+		span.SetAttributes(attrFailureReason.String(reason))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, reason)
+	}
+	span.End()
+}
+
+// setSpanAttributes adds the attributes to the span of the context, if any.
+func setSpanAttributes(ctx context.Context, attributes ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attributes...)
+}
+
+// hashSubject returns a pseudonym of the subject: the first 16 hex digits of its SHA-256 hash.
+// It correlates the requests of a subject without revealing its ID.
+func hashSubject(subject string) string {
+	if subject == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(subject))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,55 @@
+package keyimpl
+
+import (
+	"context"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"testing"
+)
+
+func TestProvider_Tracing(t *testing.T) {
+	issuer := newTestIssuer(t)
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	config := issuer.config()
+	config.PrincipalClaim = "sub"
+	config.SubjectPolicy = "uuid4"
+	p := NewHTTPProvider(config, newTestRedis(t), WithTracerProvider(tracerProvider))
+	require.NoError(t, p.RegisterEndpoint(models.EndpointInfo{Method: http.MethodGet, Path: "/api/reports", Roles: []string{"admin"}}))
+
+	_, err := p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports", issuer.sign(t, userClaims()))
+	require.ErrorIs(t, err, models.ErrAccessDenied)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	fetch, verify, authorize := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "keycloak.FetchJWKSet", fetch.Name)
+	assert.Contains(t, fetch.Attributes, attrJWKSSource.String("remote"))
+	assert.Equal(t, verify.SpanContext.SpanID(), fetch.Parent.SpanID())
+
+	assert.Equal(t, "keycloak.VerifyToken", verify.Name)
+	assert.Equal(t, authorize.SpanContext.SpanID(), verify.Parent.SpanID())
+
+	assert.Equal(t, "keycloak.Authorize", authorize.Name)
+	assert.Equal(t, codes.Error, authorize.Status.Code)
+	assert.Subset(t, authorize.Attributes, []attribute.KeyValue{
+		attrEndpoint.String("GET /api/reports"),
+		attrDecision.String("denied"),
+		attrFailureReason.String("missing_role"),
+		attrSubjectHash.String(hashSubject("1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60")),
+	})
+
+	exporter.Reset()
+	disabled := NewHTTPProvider(config, newTestRedis(t), WithTracerProvider(tracerProvider), WithoutTracing())
+	_, err = disabled.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/reports", issuer.sign(t, userClaims()))
+	require.NoError(t, err)
+	assert.Empty(t, exporter.GetSpans())
+}
@@ -0,0 +1,269 @@
+package keyimpl
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported values of Config.PermissionMode.
+const (
+	// PermissionModeToken checks the permissions in the authorization claim of an RPT. This is the default.
+	PermissionModeToken = "token"
+
+	// PermissionModeDecision asks the token endpoint for a decision with the uma-ticket grant.
+	PermissionModeDecision = "decision"
+)
+
+// UMA ticket grant type used to request permission decisions
+const _umaTicketGrant = "urn:ietf:params:oauth:grant-type:uma-ticket"
+
+// Maximum number of cached permission decisions
+const _decisionCacheSize = 10000
+
+// decisionCache is a bounded LRU of the permission decisions of the token endpoint.
+// Expired decisions are removed when they are looked up or evicted as least recently used.
+type decisionCache struct {
+	mu        sync.Mutex
+	decisions map[string]*list.Element
+	order     *list.List // most recently used first
+	size      int        // maximum number of decisions, _decisionCacheSize if zero
+}
+
+// decision is a cached permission decision.
+type decision struct {
+	key       string
+	granted   bool
+	expiresAt time.Time
+}
+
+// get returns the decision of the key if it hasn't expired and marks it as used.
+// An expired decision is removed.
+func (c *decisionCache) get(key string, now time.Time) (decision, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.decisions[key]
+	if !ok {
+		return decision{}, false
+	}
+
+	cached := element.Value.(*decision)
+	if !now.Before(cached.expiresAt) {
+		c.remove(element)
+		return decision{}, false
+	}
+	c.order.MoveToFront(element)
+	return *cached, true
+}
+
+// put stores the decision, evicting the least recently used decisions above the size.
+func (c *decisionCache) put(d decision) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.decisions == nil {
+		c.decisions = make(map[string]*list.Element)
+		c.order = list.New()
+	}
+
+	if element, ok := c.decisions[d.key]; ok {
+		element.Value = &d
+		c.order.MoveToFront(element)
+		return
+	}
+
+	size := c.size
+	if size <= 0 {
+		size = _decisionCacheSize
+	}
+	c.decisions[d.key] = c.order.PushFront(&d)
+	for c.order.Len() > size {
+		c.remove(c.order.Back())
+	}
+}
+
+// len returns the number of cached decisions.
+func (c *decisionCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.decisions)
+}
+
+// remove removes the element. Must be called with mu held.
+func (c *decisionCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.decisions, element.Value.(*decision).key)
+}
+
+// HasPermissions checks if the granted RPT permissions contain every required permission.
+// A resource is matched by name or ID; a required permission without scope matches any permission on the resource.
+func (p *Provider) HasPermissions(required []models.ResourcePermission, granted []models.Permission) bool {
+	for _, permission := range required {
+		found := slices.ContainsFunc(granted, func(g models.Permission) bool {
+			if g.ResourceName != permission.Resource && g.ResourceID != permission.Resource {
+				return false
+			}
+			return permission.Scope == "" || slices.Contains(g.Scopes, permission.Scope)
+		})
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsPermissionGranted checks the required Keycloak Authorization Services permissions according to
+// Config.PermissionMode. Errors of the decision request deny access.
+func (p *Provider) IsPermissionGranted(ctx context.Context, required []models.ResourcePermission, claims *models.Claims, tokenString string) bool {
+	if len(required) == 0 {
+		return true
+	}
+
+	if p.config.PermissionMode != PermissionModeDecision {
+		return p.HasPermissions(required, claims.Authorization.Permissions)
+	}
+
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	granted, err := p.RequestDecision(ctx, tokenString, expiresAt, required)
+	if err != nil {
+		p.logger.Error("Failed to request permission decision", slog.String("err", err.Error()))
+		return false
+	}
+
+	return granted
+}
+
+// RequestDecision asks the token endpoint whether the token grants the required permissions
+// (grant_type=uma-ticket, response_mode=decision). The decision is requested from the realm that issued
+// the token, for the resource server client of the realm. Decisions are cached for Config.DecisionCacheTTL,
+// but not beyond the token expiry. At most 10000 decisions are cached, evicting the least recently used ones.
+func (p *Provider) RequestDecision(ctx context.Context, tokenString string, expiresAt time.Time, required []models.ResourcePermission) (granted bool, err error) {
+	ctx, span := p.tracer.Start(ctx, "keycloak.RequestDecision")
+	defer func() {
+		span.SetAttributes(attrGranted.Bool(granted))
+		endSpan(span, err, "decision_request_failed")
+	}()
+
+	permissions := make([]string, 0, len(required))
+	for _, permission := range required {
+		permissions = append(permissions, permission.String())
+	}
+	sum := sha256.Sum256([]byte(tokenString + "\n" + strings.Join(permissions, "\n")))
+	key := hex.EncodeToString(sum[:])
+
+	cached, ok := p.decisions.get(key, time.Now())
+	span.SetAttributes(attrCached.Bool(ok))
+	if ok {
+		return cached.granted, nil
+	}
+
+	granted, err = p.requestDecision(ctx, tokenString, permissions)
+	if err != nil {
+		return false, err
+	}
+
+	ttl := p.config.DecisionCacheTTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	cacheUntil := time.Now().Add(ttl)
+	if !expiresAt.IsZero() && expiresAt.Before(cacheUntil) {
+		cacheUntil = expiresAt
+	}
+
+	p.decisions.put(decision{key: key, granted: granted, expiresAt: cacheUntil})
+
+	return granted, nil
+}
+
+// requestDecision sends the decision request to the token endpoint of the token's realm.
+func (p *Provider) requestDecision(ctx context.Context, tokenString string, permissions []string) (bool, error) {
+	realm, err := p.TokenRealm(ctx, tokenString)
+	if err != nil {
+		return false, err
+	}
+
+	uri, err := p.realmTokenEndpoint(ctx, realm)
+	if err != nil {
+		return false, err
+	}
+
+	form := url.Values{
+		"grant_type":    {_umaTicketGrant},
+		"audience":      {realm.ClientID},
+		"response_mode": {"decision"},
+		"permission":    permissions,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var body struct {
+			Result bool `json:"result"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return false, fmt.Errorf("cannot decode decision response: %w", err)
+		}
+		return body.Result, nil
+	case http.StatusForbidden:
+		return false, nil
+	default:
+		return false, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+}
+
+// realmTokenEndpoint returns the token endpoint of the realm. The configured token endpoint is used for
+// the default realm and the realm of Config.IssuerURI; other realms use the Keycloak token endpoint of their issuer.
+func (p *Provider) realmTokenEndpoint(ctx context.Context, realm Realm) (string, error) {
+	if realm.Issuer == "" || realm.Issuer == strings.TrimSuffix(p.config.IssuerURI, "/") {
+		return p.tokenEndpoint(ctx)
+	}
+	return realm.Issuer + "/protocol/openid-connect/token", nil
+}
+
+// tokenEndpoint returns the token endpoint URI, discovering it on first use.
+func (p *Provider) tokenEndpoint(ctx context.Context) (string, error) {
+	p.endpointMu.Lock()
+	defer p.endpointMu.Unlock()
+
+	if p.tokenURI != "" {
+		return p.tokenURI, nil
+	}
+
+	uri, err := p.config.TokenEndpoint(ctx, p.httpClient)
+	if err != nil {
+		p.logger.Error("Failed to resolve token endpoint", slog.String("err", err.Error()))
+		return "", err
+	}
+
+	p.tokenURI = uri
+	return uri, nil
+}
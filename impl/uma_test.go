@@ -0,0 +1,164 @@
+package keyimpl
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProvider_HasPermissions(t *testing.T) {
+	granted := []models.Permission{
+		{ResourceID: "7c0e", ResourceName: "invoice", Scopes: []string{"view", "edit"}},
+		{ResourceID: "9a1f", ResourceName: "payout"},
+	}
+
+	test := []struct {
+		name     string
+		required []models.ResourcePermission
+		expected bool
+	}{
+		{name: "No requirement", expected: true},
+		{name: "Resource and scope", required: []models.ResourcePermission{{Resource: "invoice", Scope: "view"}}, expected: true},
+		{name: "Resource by ID", required: []models.ResourcePermission{{Resource: "7c0e", Scope: "edit"}}, expected: true},
+		{name: "Resource without scope", required: []models.ResourcePermission{{Resource: "payout"}}, expected: true},
+		{name: "Missing scope", required: []models.ResourcePermission{{Resource: "invoice", Scope: "delete"}}, expected: false},
+		{name: "Missing resource", required: []models.ResourcePermission{{Resource: "refund", Scope: "view"}}, expected: false},
+		{
+			name:     "One of several missing",
+			required: []models.ResourcePermission{{Resource: "invoice", Scope: "view"}, {Resource: "payout", Scope: "approve"}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewHTTPProvider(&Config{}, nil)
+
+			assert.Equal(t, tt.expected, p.HasPermissions(tt.required, granted))
+		})
+	}
+}
+
+func TestProvider_RequestDecision(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, _umaTicketGrant, r.PostForm.Get("grant_type"))
+		assert.Equal(t, "decision", r.PostForm.Get("response_mode"))
+		assert.Equal(t, "aibolit-api", r.PostForm.Get("audience"))
+
+		switch {
+		case r.Header.Get("Authorization") == "Bearer broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case slices.Contains(r.PostForm["permission"], "invoice#view"):
+			_ = json.NewEncoder(w).Encode(map[string]bool{"result": true})
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "access_denied"})
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	p := NewHTTPProvider(&Config{
+		ClientID:         "aibolit-api",
+		TokenURI:         server.URL,
+		PermissionMode:   PermissionModeDecision,
+		DecisionCacheTTL: time.Minute,
+	}, nil)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+	view := []models.ResourcePermission{{Resource: "invoice", Scope: "view"}}
+	edit := []models.ResourcePermission{{Resource: "invoice", Scope: "edit"}}
+
+	granted, err := p.RequestDecision(ctx, "token", expiresAt, view)
+	require.NoError(t, err)
+	assert.True(t, granted)
+
+	granted, err = p.RequestDecision(ctx, "token", expiresAt, view)
+	require.NoError(t, err)
+	assert.True(t, granted)
+	assert.Equal(t, int32(1), requests.Load(), "decision is cached")
+
+	granted, err = p.RequestDecision(ctx, "token", expiresAt, edit)
+	require.NoError(t, err)
+	assert.False(t, granted)
+	assert.Equal(t, int32(2), requests.Load())
+
+	_, err = p.RequestDecision(ctx, "broken", expiresAt, view)
+	require.Error(t, err)
+
+	assert.False(t, p.IsPermissionGranted(ctx, view, &models.Claims{}, "broken"), "errors deny access")
+	assert.True(t, p.IsPermissionGranted(ctx, view, &models.Claims{}, "token"))
+}
+
+func TestProvider_RequestDecision_Realms(t *testing.T) {
+	var audiences sync.Map
+	mux := http.NewServeMux()
+	for realm, client := range map[string]string{"customer-a": "aibolit-api", "customer-b": "portal"} {
+		mux.HandleFunc("POST /realms/"+realm+"/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, r.ParseForm())
+			audiences.Store(realm, r.PostForm.Get("audience"))
+			_ = json.NewEncoder(w).Encode(map[string]bool{"result": r.PostForm.Get("audience") == client})
+		})
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	issuer := newTestIssuer(t)
+	p := NewHTTPProvider(&Config{
+		ClientID:       "aibolit-api",
+		PermissionMode: PermissionModeDecision,
+		Realms: []Realm{
+			{Issuer: server.URL + "/realms/customer-a", PublicJWKUri: issuer.URL},
+			{Issuer: server.URL + "/realms/customer-b", PublicJWKUri: issuer.URL, ClientID: "portal"},
+		},
+	}, nil)
+	view := []models.ResourcePermission{{Resource: "invoice", Scope: "view"}}
+
+	for _, realm := range []string{"customer-a", "customer-b"} {
+		claims := userClaims()
+		claims["iss"] = server.URL + "/realms/" + realm
+
+		granted, err := p.RequestDecision(context.Background(), issuer.sign(t, claims), time.Now().Add(time.Hour), view)
+		require.NoError(t, err)
+		assert.True(t, granted, realm)
+	}
+
+	audience, _ := audiences.Load("customer-a")
+	assert.Equal(t, "aibolit-api", audience)
+	audience, _ = audiences.Load("customer-b")
+	assert.Equal(t, "portal", audience)
+}
+
+func TestDecisionCache(t *testing.T) {
+	cache := decisionCache{size: 2}
+	now := time.Now()
+
+	cache.put(decision{key: "a", granted: true, expiresAt: now.Add(time.Minute)})
+	cache.put(decision{key: "b", granted: false, expiresAt: now.Add(time.Minute)})
+	_, ok := cache.get("a", now)
+	require.True(t, ok)
+
+	cache.put(decision{key: "c", granted: true, expiresAt: now.Add(time.Second)})
+	assert.Equal(t, 2, cache.len(), "cache is bounded")
+	_, ok = cache.get("b", now)
+	assert.False(t, ok, "least recently used decision is evicted")
+
+	cached, ok := cache.get("a", now)
+	require.True(t, ok)
+	assert.True(t, cached.granted)
+
+	_, ok = cache.get("c", now.Add(time.Second))
+	assert.False(t, ok, "expired decision isn't returned")
+	assert.Equal(t, 1, cache.len(), "expired decision is removed")
+}
@@ -0,0 +1,66 @@
+// Package keymetrics defines the metrics recorded by the authentication provider.
+// Adapters for metrics backends, e.g. Prometheus, implement the Recorder interface.
+package keymetrics
+
+import "time"
+
+// Outcomes of recorded operations.
+const (
+	// OutcomeSuccess - the token was verified or the JWK set was fetched.
+	OutcomeSuccess = "success"
+
+	// OutcomeFailure - the token or the JWK set fetch was rejected.
+	OutcomeFailure = "failure"
+
+	// OutcomeAllowed - access was granted.
+	OutcomeAllowed = "allowed"
+
+	// OutcomeDenied - access was denied.
+	OutcomeDenied = "denied"
+)
+
+// Sources a JWK set is fetched from.
+const (
+	// SourceMemory - the in-memory cache of a realm.
+	SourceMemory = "memory"
+
+	// SourceCache - the Redis cache.
+	SourceCache = "cache"
+
+	// SourceRemote - the JWKS endpoint of the realm.
+	SourceRemote = "remote"
+)
+
+// Transports of authorization requests.
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// Recorder records the metrics of token verification and authorization.
+// Implementations must be safe for concurrent use.
+type Recorder interface {
+	// TokenVerified records a token verification with its outcome and, for failures, the reason.
+	TokenVerified(outcome, reason string, duration time.Duration)
+
+	// JWKSFetched records a JWK set lookup by the source it was served from.
+	// Fetches from SourceRemote are the refreshes; the other sources are cache hits.
+	JWKSFetched(source, outcome string, duration time.Duration)
+
+	// Authorized records an authorization decision of the transport with its outcome and, for denials, the reason.
+	Authorized(transport, outcome, reason string, duration time.Duration)
+
+	// AuditDropped records an audit event of the decision (allowed or denied) dropped by an asynchronous sink.
+	AuditDropped(decision string)
+}
+
+// Nop is a Recorder discarding all metrics. It's used by default.
+var Nop Recorder = nop{}
+
+// nop discards all metrics.
+type nop struct{}
+
+func (nop) TokenVerified(string, string, time.Duration)      {}
+func (nop) JWKSFetched(string, string, time.Duration)        {}
+func (nop) Authorized(string, string, string, time.Duration) {}
+func (nop) AuditDropped(string)                              {}
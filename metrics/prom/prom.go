@@ -0,0 +1,112 @@
+// Package keyprom exposes the metrics of the authentication provider to Prometheus.
+package keyprom
+
+import (
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+var _ keymetrics.Recorder = (*Recorder)(nil)
+
+// Recorder records the metrics of the authentication provider as Prometheus metrics:
+//
+//   - keycloak_auth_token_verifications_total{outcome, reason}
+//   - keycloak_auth_token_verification_duration_seconds{outcome}
+//   - keycloak_auth_jwks_fetches_total{source, outcome}
+//   - keycloak_auth_jwks_fetch_duration_seconds{source}
+//   - keycloak_auth_authorizations_total{transport, outcome, reason}
+//   - keycloak_auth_authorization_duration_seconds{transport, outcome}
+//   - keycloak_auth_audit_events_dropped_total{decision}
+//
+// The JWKS cache hit ratio is the share of fetches with a source other than "remote":
+//
+//	sum(rate(keycloak_auth_jwks_fetches_total{source!="remote"}[5m])) / sum(rate(keycloak_auth_jwks_fetches_total[5m]))
+type Recorder struct {
+	verifications         *prometheus.CounterVec
+	verificationDuration  *prometheus.HistogramVec
+	fetches               *prometheus.CounterVec
+	fetchDuration         *prometheus.HistogramVec
+	authorizations        *prometheus.CounterVec
+	authorizationDuration *prometheus.HistogramVec
+	auditDrops            *prometheus.CounterVec
+}
+
+// New creates a Recorder and registers its metrics with the registerer.
+//
+// Example:
+//
+//	provider := keyimpl.NewHTTPProvider(config, redisClient, keyimpl.WithMetrics(keyprom.New(prometheus.DefaultRegisterer)))
+func New(registerer prometheus.Registerer) *Recorder {
+	r := &Recorder{
+		verifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "keycloak_auth",
+			Name:      "token_verifications_total",
+			Help:      "Number of token verifications by outcome and failure reason.",
+		}, []string{"outcome", "reason"}),
+		verificationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "keycloak_auth",
+			Name:      "token_verification_duration_seconds",
+			Help:      "Duration of token verifications.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"outcome"}),
+		fetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "keycloak_auth",
+			Name:      "jwks_fetches_total",
+			Help:      "Number of JWK set lookups by source (memory, cache, remote) and outcome.",
+		}, []string{"source", "outcome"}),
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "keycloak_auth",
+			Name:      "jwks_fetch_duration_seconds",
+			Help:      "Duration of JWK set lookups by source.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"source"}),
+		authorizations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "keycloak_auth",
+			Name:      "authorizations_total",
+			Help:      "Number of authorization decisions by transport, outcome and denial reason.",
+		}, []string{"transport", "outcome", "reason"}),
+		authorizationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "keycloak_auth",
+			Name:      "authorization_duration_seconds",
+			Help:      "Duration of authorization decisions.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"transport", "outcome"}),
+		auditDrops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "keycloak_auth",
+			Name:      "audit_events_dropped_total",
+			Help:      "Number of audit events dropped by asynchronous sinks by decision.",
+		}, []string{"decision"}),
+	}
+
+	registerer.MustRegister(
+		r.verifications, r.verificationDuration,
+		r.fetches, r.fetchDuration,
+		r.authorizations, r.authorizationDuration,
+		r.auditDrops,
+	)
+	return r
+}
+
+// TokenVerified implements keymetrics.Recorder.
+func (r *Recorder) TokenVerified(outcome, reason string, duration time.Duration) {
+	r.verifications.WithLabelValues(outcome, reason).Inc()
+	r.verificationDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+}
+
+// JWKSFetched implements keymetrics.Recorder.
+func (r *Recorder) JWKSFetched(source, outcome string, duration time.Duration) {
+	r.fetches.WithLabelValues(source, outcome).Inc()
+	r.fetchDuration.WithLabelValues(source).Observe(duration.Seconds())
+}
+
+// Authorized implements keymetrics.Recorder.
+func (r *Recorder) Authorized(transport, outcome, reason string, duration time.Duration) {
+	r.authorizations.WithLabelValues(transport, outcome, reason).Inc()
+	r.authorizationDuration.WithLabelValues(transport, outcome).Observe(duration.Seconds())
+}
+
+// AuditDropped implements keymetrics.Recorder.
+func (r *Recorder) AuditDropped(decision string) {
+	r.auditDrops.WithLabelValues(decision).Inc()
+}
@@ -0,0 +1,27 @@
+package keyprom
+
+import (
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	r := New(registry)
+
+	r.TokenVerified(keymetrics.OutcomeFailure, "expired", time.Millisecond)
+	r.JWKSFetched(keymetrics.SourceCache, keymetrics.OutcomeSuccess, time.Millisecond)
+	r.JWKSFetched(keymetrics.SourceRemote, keymetrics.OutcomeSuccess, 10*time.Millisecond)
+	r.Authorized(keymetrics.TransportGRPC, keymetrics.OutcomeDenied, "access_denied", time.Millisecond)
+	r.AuditDropped("denied")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.verifications.WithLabelValues(keymetrics.OutcomeFailure, "expired")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.fetches.WithLabelValues(keymetrics.SourceCache, keymetrics.OutcomeSuccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.authorizations.WithLabelValues(keymetrics.TransportGRPC, keymetrics.OutcomeDenied, "access_denied")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(r.auditDrops.WithLabelValues("denied")))
+	assert.Equal(t, 9, testutil.CollectAndCount(registry), "series of every metric")
+}
@@ -1,6 +1,10 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 var (
 	// ErrInvalidToken represents the error that occurs when a token is invalid.
@@ -14,4 +18,177 @@ var (
 
 	// ErrUnexpectedSigningMethod represents an error that occurs when the token signing method is unexpected.
 	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+
+	// ErrInsufficientUserAuthentication represents the error that occurs when the user authenticated
+	// with a weaker method than the endpoint requires and has to step up.
+	ErrInsufficientUserAuthentication = errors.New("insufficient user authentication")
+
+	// ErrInvalidDPoPProof represents the error that occurs when the DPoP proof is missing, invalid or replayed.
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+	// ErrInsufficientScope represents the error that occurs when the token lacks the scopes required by the endpoint.
+	ErrInsufficientScope = errors.New("insufficient scope")
+)
+
+// StepUpError is returned when the token's acr or amr claims do not satisfy the endpoint requirements.
+// It matches ErrInsufficientUserAuthentication via errors.Is and carries the requirements,
+// so callers can build an RFC 9470 challenge.
+type StepUpError struct {
+	// ACR is the minimum authentication context class reference required by the endpoint.
+	ACR string
+
+	// AMR is the list of authentication methods required by the endpoint.
+	AMR []string
+}
+
+// Error implements the error interface.
+func (e *StepUpError) Error() string {
+	return fmt.Sprintf("%s: required acr %q, amr [%s]",
+		ErrInsufficientUserAuthentication, e.ACR, strings.Join(e.AMR, " "))
+}
+
+// Is reports whether the target is ErrInsufficientUserAuthentication.
+func (e *StepUpError) Is(target error) bool {
+	return target == ErrInsufficientUserAuthentication
+}
+
+// ScopeError is returned when the token's scopes do not satisfy the endpoint requirements.
+// It matches both ErrInsufficientScope and ErrAccessDenied via errors.Is and carries the required scopes,
+// so callers can build an RFC 6750 challenge.
+type ScopeError struct {
+	// Scopes is the list of scopes required by the endpoint.
+	Scopes []string
+}
+
+// Error implements the error interface.
+func (e *ScopeError) Error() string {
+	return fmt.Sprintf("%s: required scope [%s]", ErrInsufficientScope, strings.Join(e.Scopes, " "))
+}
+
+// Is reports whether the target is ErrInsufficientScope or ErrAccessDenied.
+func (e *ScopeError) Is(target error) bool {
+	return target == ErrInsufficientScope || target == ErrAccessDenied
+}
+
+// Reason is a machine-readable reason of an authentication or authorization failure.
+type Reason string
+
+// Reasons of token verification failures. They match ErrInvalidToken.
+const (
+	ReasonInvalidToken            Reason = "invalid_token"
+	ReasonMalformed               Reason = "malformed"
+	ReasonExpired                 Reason = "expired"
+	ReasonRevoked                 Reason = "revoked"
+	ReasonNotYetValid             Reason = "not_yet_valid"
+	ReasonBadSignature            Reason = "bad_signature"
+	ReasonUnknownKeyID            Reason = "unknown_kid"
+	ReasonUnexpectedSigningMethod Reason = "unexpected_signing_method"
+	ReasonDecryptionFailed        Reason = "decryption_failed"
+	ReasonWrongIssuer             Reason = "wrong_issuer"
+	ReasonWrongAudience           Reason = "wrong_audience"
+	ReasonInvalidSubject          Reason = "invalid_subject"
+	ReasonInvalidClaims           Reason = "invalid_claims"
+	ReasonInvalidBinding          Reason = "invalid_binding"
 )
+
+// Reasons of authorization failures.
+const (
+	// ReasonInvalidDPoPProof matches ErrInvalidDPoPProof.
+	ReasonInvalidDPoPProof Reason = "invalid_dpop_proof"
+
+	// ReasonInsufficientScope matches ErrInsufficientScope and ErrAccessDenied.
+	ReasonInsufficientScope Reason = "insufficient_scope"
+
+	// ReasonInsufficientAuthentication matches ErrInsufficientUserAuthentication.
+	ReasonInsufficientAuthentication Reason = "insufficient_authentication"
+
+	// The remaining reasons match ErrAccessDenied.
+	ReasonAccessDenied      Reason = "access_denied"
+	ReasonClientNotAllowed  Reason = "client_not_allowed"
+	ReasonMissingRole       Reason = "missing_role"
+	ReasonMissingGroup      Reason = "missing_group"
+	ReasonMissingPermission Reason = "missing_permission"
+	ReasonPolicyDenied      Reason = "policy_denied"
+)
+
+// Sentinel returns the sentinel error the reason belongs to, e.g. ErrInvalidToken for ReasonExpired.
+func (r Reason) Sentinel() error {
+	switch r {
+	case ReasonInvalidToken, ReasonMalformed, ReasonExpired, ReasonRevoked, ReasonNotYetValid, ReasonBadSignature,
+		ReasonUnknownKeyID, ReasonUnexpectedSigningMethod, ReasonDecryptionFailed, ReasonWrongIssuer,
+		ReasonWrongAudience, ReasonInvalidSubject, ReasonInvalidClaims, ReasonInvalidBinding:
+		return ErrInvalidToken
+	case ReasonInvalidDPoPProof:
+		return ErrInvalidDPoPProof
+	case ReasonInsufficientScope:
+		return ErrInsufficientScope
+	case ReasonInsufficientAuthentication:
+		return ErrInsufficientUserAuthentication
+	default:
+		return ErrAccessDenied
+	}
+}
+
+// AuthError is returned when a request fails authentication or authorization.
+// It carries the machine-readable reason and matches the sentinel error of the reason via errors.Is,
+// e.g. ErrInvalidToken for ReasonExpired, so existing checks keep working:
+//
+//	var authErr *models.AuthError
+//	if errors.As(err, &authErr) && authErr.Reason == models.ReasonExpired {
+//	    // ask the client to refresh the token
+//	}
+type AuthError struct {
+	// Reason is the machine-readable reason of the failure.
+	Reason Reason
+
+	// Required lists what the endpoint requires, e.g. the roles, groups, scopes or permissions the token lacks.
+	Required []string
+
+	// Err is the underlying error, e.g. the error of the JWT library, a *StepUpError or a *ScopeError.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *AuthError) Error() string {
+	sentinel := e.Reason.Sentinel()
+	switch {
+	case e.Err == nil:
+		return fmt.Sprintf("%s: %s", sentinel, e.Reason)
+	case errors.Is(e.Err, sentinel):
+		return e.Err.Error()
+	default:
+		return fmt.Sprintf("%s: %s", sentinel, e.Err)
+	}
+}
+
+// Is reports whether the target is the sentinel error of the reason.
+func (e *AuthError) Is(target error) bool {
+	return target == e.Reason.Sentinel() || (e.Reason == ReasonInsufficientScope && target == ErrAccessDenied)
+}
+
+// Unwrap returns the underlying error.
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// ReasonOf returns the reason of the error: the reason of an AuthError in its chain or,
+// for other errors, the reason of the sentinel error they match.
+func ReasonOf(err error) Reason {
+	var authErr *AuthError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &authErr):
+		return authErr.Reason
+	case errors.Is(err, ErrInvalidDPoPProof):
+		return ReasonInvalidDPoPProof
+	case errors.Is(err, ErrInvalidToken):
+		return ReasonInvalidToken
+	case errors.Is(err, ErrInsufficientUserAuthentication):
+		return ReasonInsufficientAuthentication
+	case errors.Is(err, ErrInsufficientScope):
+		return ReasonInsufficientScope
+	default:
+		return ReasonAccessDenied
+	}
+}
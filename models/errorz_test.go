@@ -0,0 +1,84 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAuthError_Is(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      *AuthError
+		matches  []error
+		excludes []error
+	}{
+		{
+			name:     "Token reason",
+			err:      &AuthError{Reason: ReasonExpired},
+			matches:  []error{ErrInvalidToken},
+			excludes: []error{ErrAccessDenied},
+		},
+		{
+			name:     "Revoked token",
+			err:      &AuthError{Reason: ReasonRevoked},
+			matches:  []error{ErrInvalidToken},
+			excludes: []error{ErrAccessDenied},
+		},
+		{
+			name:     "Access reason",
+			err:      &AuthError{Reason: ReasonMissingRole, Required: []string{"admin"}},
+			matches:  []error{ErrAccessDenied},
+			excludes: []error{ErrInvalidToken},
+		},
+		{
+			name:    "Insufficient scope",
+			err:     &AuthError{Reason: ReasonInsufficientScope, Err: &ScopeError{Scopes: []string{"read"}}},
+			matches: []error{ErrInsufficientScope, ErrAccessDenied},
+		},
+		{
+			name:     "DPoP proof",
+			err:      &AuthError{Reason: ReasonInvalidDPoPProof},
+			matches:  []error{ErrInvalidDPoPProof},
+			excludes: []error{ErrInvalidToken},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := fmt.Errorf("authorize: %w", tt.err)
+			for _, target := range tt.matches {
+				assert.ErrorIs(t, wrapped, target)
+			}
+			for _, target := range tt.excludes {
+				assert.NotErrorIs(t, wrapped, target)
+			}
+			assert.Equal(t, tt.err.Reason, ReasonOf(wrapped))
+		})
+	}
+}
+
+func TestAuthError_Unwrap(t *testing.T) {
+	stepUp := &StepUpError{ACR: "gold"}
+	err := error(&AuthError{Reason: ReasonInsufficientAuthentication, Err: stepUp})
+
+	var target *StepUpError
+	require.ErrorAs(t, err, &target)
+	assert.Equal(t, stepUp, target)
+	assert.ErrorIs(t, err, ErrInsufficientUserAuthentication)
+}
+
+func TestAuthError_Error(t *testing.T) {
+	assert.Equal(t, "access denied: missing_role", (&AuthError{Reason: ReasonMissingRole}).Error())
+	assert.Equal(t, "invalid token: boom",
+		(&AuthError{Reason: ReasonInvalidToken, Err: errors.New("boom")}).Error())
+}
+
+func TestReasonOf(t *testing.T) {
+	assert.Equal(t, Reason(""), ReasonOf(nil))
+	assert.Equal(t, ReasonInvalidToken, ReasonOf(ErrInvalidToken))
+	assert.Equal(t, ReasonInsufficientScope, ReasonOf(&ScopeError{}))
+	assert.Equal(t, ReasonAccessDenied, ReasonOf(errors.New("unknown")))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"strings"
 )
 
 // Claims represents the standard and additional fields that may be present in a JWT token.
@@ -24,6 +25,9 @@ type Claims struct {
 	// Acr is the authentication context class reference.
 	Acr string `json:"acr,omitempty"`
 
+	// Amr is the list of authentication methods used to authenticate the user.
+	Amr []string `json:"amr,omitempty"`
+
 	// AllowedOrigins is a list of allowed origins for requests.
 	AllowedOrigins []string `json:"allowed-origins,omitempty"`
 
@@ -53,6 +57,108 @@ type Claims struct {
 
 	// Email is the user's email address.
 	Email string `json:"email,omitempty"`
+
+	// ClientID is the ID of the client a service account token was issued to.
+	ClientID string `json:"client_id,omitempty"`
+
+	// LegacyClientID is the ID of the client a service account token was issued to, as emitted by older Keycloak versions.
+	LegacyClientID string `json:"clientId,omitempty"`
+
+	// Authorization contains the permissions granted by Keycloak Authorization Services in an RPT.
+	Authorization Authorization `json:"authorization,omitempty"`
+
+	// Cnf contains the confirmation claim binding the token to a key.
+	Cnf Confirmation `json:"cnf,omitempty"`
+
+	// Groups is a list of full group paths the user is a member of.
+	Groups []string `json:"groups,omitempty"`
+
+	// Raw contains every claim of the token, including the ones without a dedicated field.
+	// Numbers are kept as json.Number.
+	Raw map[string]any `json:"-"`
+}
+
+// UnmarshalJSON implements custom JSON deserialization for Claims, keeping a copy of all claims in Raw.
+func (c *Claims) UnmarshalJSON(bytes []byte) error {
+	type claims Claims
+	if err := json.Unmarshal(bytes, (*claims)(c)); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(bytes)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c.Raw); err != nil {
+		return fmt.Errorf("cannot unmarshal raw claims: %w", err)
+	}
+
+	return nil
+}
+
+// Lookup returns the raw claim at the dot-separated path, e.g. "address.country".
+func (c *Claims) Lookup(path string) (any, bool) {
+	var value any = c.Raw
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// CallingClient returns the ID of the client that obtained the token.
+func (c *Claims) CallingClient() string {
+	switch {
+	case c.ClientID != "":
+		return c.ClientID
+	case c.LegacyClientID != "":
+		return c.LegacyClientID
+	default:
+		return c.Azp
+	}
+}
+
+// IsServiceAccount reports whether the token was obtained with the client credentials grant.
+// Only the client_id (clientId) claim issued by Keycloak is trusted, since users may choose
+// a username looking like a service account's.
+func (c *Claims) IsServiceAccount() bool {
+	return c.ClientID != "" || c.LegacyClientID != ""
+}
+
+// Scopes returns the space-separated scope claim as a list of scopes.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Authorization represents the authorization claim of a requesting party token (RPT).
+type Authorization struct {
+	// Permissions is a list of permissions granted to the requesting party.
+	Permissions []Permission `json:"permissions,omitempty"`
+}
+
+// Permission represents a resource and the scopes granted on it.
+type Permission struct {
+	// ResourceID is the ID of the resource.
+	ResourceID string `json:"rsid,omitempty"`
+
+	// ResourceName is the name of the resource.
+	ResourceName string `json:"rsname,omitempty"`
+
+	// Scopes is a list of scopes granted on the resource.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// Confirmation represents the confirmation claim of a sender-constrained token.
+type Confirmation struct {
+	// JKT is the base64url encoded SHA-256 JWK thumbprint of the DPoP key the token is bound to (RFC 9449).
+	JKT string `json:"jkt,omitempty"`
+
+	// X5tS256 is the base64url encoded SHA-256 thumbprint of the client certificate the token is bound to (RFC 8705).
+	X5tS256 string `json:"x5t#S256,omitempty"`
 }
 
 // RealmAccess represents the roles available in the realm.
@@ -73,3 +73,80 @@ func TestResourceAccess_MarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestClaims_Lookup(t *testing.T) {
+	claims := Claims{ResourceAccess: ResourceAccess{ClientID: "aibolit-api"}}
+	err := json.Unmarshal([]byte(`{
+		"sub": "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60",
+		"tenant_id": "acme",
+		"employee_number": 4711,
+		"address": {"country": "DE"},
+		"resource_access": {"aibolit-api": {"roles": ["user"]}}
+	}`), &claims)
+	require.NoError(t, err)
+
+	assert.Equal(t, "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60", claims.Subject)
+	assert.Equal(t, []string{"user"}, claims.ResourceAccess.Client.Roles)
+
+	value, ok := claims.Lookup("tenant_id")
+	require.True(t, ok)
+	assert.Equal(t, "acme", value)
+
+	value, ok = claims.Lookup("employee_number")
+	require.True(t, ok)
+	assert.Equal(t, json.Number("4711"), value)
+
+	value, ok = claims.Lookup("address.country")
+	require.True(t, ok)
+	assert.Equal(t, "DE", value)
+
+	_, ok = claims.Lookup("address.city")
+	assert.False(t, ok)
+
+	_, ok = claims.Lookup("tenant_id.name")
+	assert.False(t, ok)
+}
+
+func TestClaims_ServiceAccount(t *testing.T) {
+	test := []struct {
+		name             string
+		input            []byte
+		expectedClient   string
+		isServiceAccount bool
+	}{
+		{
+			name:             "Human user",
+			input:            []byte(`{"azp": "web-app", "preferred_username": "jdoe"}`),
+			expectedClient:   "web-app",
+			isServiceAccount: false,
+		},
+		{
+			name:             "Service account with client_id",
+			input:            []byte(`{"azp": "billing", "client_id": "billing", "preferred_username": "service-account-billing"}`),
+			expectedClient:   "billing",
+			isServiceAccount: true,
+		},
+		{
+			name:             "Service account with legacy clientId",
+			input:            []byte(`{"azp": "billing", "clientId": "billing"}`),
+			expectedClient:   "billing",
+			isServiceAccount: true,
+		},
+		{
+			name:             "User named like a service account",
+			input:            []byte(`{"azp": "web-app", "preferred_username": "service-account-billing"}`),
+			expectedClient:   "web-app",
+			isServiceAccount: false,
+		},
+	}
+
+	for _, tt := range test {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims Claims
+			require.NoError(t, json.Unmarshal(tt.input, &claims))
+
+			assert.Equal(t, tt.expectedClient, claims.CallingClient())
+			assert.Equal(t, tt.isServiceAccount, claims.IsServiceAccount())
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+// ClaimType represents the type a mapped claim value is converted to.
+type ClaimType int
+
+const (
+	// ClaimAny keeps the claim value as decoded from JSON (numbers as json.Number).
+	ClaimAny ClaimType = iota
+
+	// ClaimString converts the claim value to a string.
+	ClaimString
+
+	// ClaimInt converts the claim value to an int64.
+	ClaimInt
+
+	// ClaimFloat converts the claim value to a float64.
+	ClaimFloat
+
+	// ClaimBool converts the claim value to a bool.
+	ClaimBool
+
+	// ClaimStringSlice converts the claim value to a []string. A single value becomes a one-element slice.
+	ClaimStringSlice
+
+	// ClaimTime converts a NumericDate (seconds since epoch) or an RFC 3339 string to a time.Time.
+	ClaimTime
+)
+
+// ClaimMapping describes an extra claim that is extracted from the token into User.Attributes.
+type ClaimMapping struct {
+	// Name is the key under which the value is stored in User.Attributes.
+	// If empty, Path is used.
+	Name string
+
+	// Path is the dot-separated path of the claim in the token payload, e.g. "tenant_id" or "address.country".
+	Path string
+
+	// Type is the type the claim value is converted to.
+	Type ClaimType
+
+	// Required rejects the token as invalid when the claim is missing.
+	Required bool
+}
@@ -11,10 +11,22 @@ const (
 	GRPCProvider
 )
 
+// ScopeMatch defines how the scopes required by an endpoint are matched against the token scopes.
+type ScopeMatch int
+
+const (
+	// ScopeMatchAny requires the token to carry at least one of the endpoint scopes. This is the default.
+	ScopeMatchAny ScopeMatch = iota
+
+	// ScopeMatchAll requires the token to carry every endpoint scope.
+	ScopeMatchAll
+)
+
 // EndpointInfo defines the structure for protecting specific endpoints with role-based access control.
 // It contains the necessary information to identify and secure an endpoint.
 type EndpointInfo struct {
 	// Path represents the endpoint path for HTTP routes or the full method name for gRPC services.
+	// HTTP paths may contain "{name}" segments matching a single path segment, e.g. "/api/users/{id}".
 	Path string
 
 	// Method specifies the HTTP method (GET, POST, etc.). This field is only used for HTTP endpoints
@@ -24,6 +36,69 @@ type EndpointInfo struct {
 	// Roles is a list of role names that are allowed to access this endpoint.
 	// Users must have at least one of these roles to be granted access.
 	Roles []string
+
+	// Clients is a list of client IDs allowed to call this endpoint.
+	// The token must have been obtained by one of these clients. Leave empty to allow any client.
+	Clients []string
+
+	// Principal restricts the endpoint to users or to service accounts. Leave zero to allow both.
+	Principal PrincipalKind
+
+	// Groups is a list of group paths allowed to access this endpoint.
+	// Users must be a member of at least one of them. A path ending with "/*" matches
+	// any subgroup below it, e.g. "/org/finance/*" matches "/org/finance/approvers".
+	Groups []string
+
+	// Scopes is a list of OAuth2 scopes required to access this endpoint.
+	// How they are matched is controlled by ScopeMatch. Leave empty to skip the check.
+	Scopes []string
+
+	// ScopeMatch specifies whether any or all of the Scopes must be granted to the token.
+	ScopeMatch ScopeMatch
+
+	// Permissions is a list of Keycloak Authorization Services permissions required to access this endpoint.
+	// Every permission must be granted. Leave empty to skip the check.
+	Permissions []ResourcePermission
+
+	// ACR is the minimum authentication context class reference the token must carry.
+	// Levels are compared using the ordering from Config.ACRValues. Leave empty to skip the check.
+	ACR string
+
+	// AMR is a list of authentication methods (e.g. "otp", "hwk") that must all be present
+	// in the token's amr claim. Leave empty to skip the check.
+	AMR []string
+
+	// Policy is an optional attribute-based check evaluated with the user, the claims and the request,
+	// e.g. to verify ownership or tenancy. A non-nil error denies access.
+	Policy Policy
+
+	// Condition is an optional CEL expression that must evaluate to true to grant access, e.g.
+	// `"approvers" in user.groups && claims.tenant_id == request.params.tenant`.
+	// It can refer to claims (raw token claims), user (id, kind, client_id, username, email, name, family_name,
+	// roles, groups, scopes, attributes) and request (method, path, headers, params). The expression is compiled
+	// and type-checked at registration; evaluation errors deny access.
+	Condition string
+
+	// RequireCertificateBinding requires the token to be bound to the client certificate
+	// presented over mutual TLS (RFC 8705). Certificate-bound tokens are checked on every endpoint.
+	RequireCertificateBinding bool
+}
+
+// ResourcePermission identifies a resource and scope defined in Keycloak Authorization Services.
+type ResourcePermission struct {
+	// Resource is the name or ID of the resource, e.g. "invoice".
+	Resource string
+
+	// Scope is the scope on the resource, e.g. "view". Leave empty to require any permission on the resource.
+	Scope string
+}
+
+// String returns the permission in the "resource#scope" form used in UMA ticket requests.
+func (p ResourcePermission) String() string {
+	if p.Scope == "" {
+		return p.Resource
+	}
+	return p.Resource + "#" + p.Scope
 }
 
 // SecureEndpoint represents the endpoint details for secure access control.
@@ -45,3 +120,16 @@ type SecureEndpoint struct {
 	// and should be left empty for gRPC endpoints.
 	Method string
 }
+
+// OpenIDConfiguration represents the subset of the OpenID Provider metadata used by the library.
+// It is served by Keycloak at "{issuer}/.well-known/openid-configuration".
+type OpenIDConfiguration struct {
+	// Issuer is the issuer identifier of the realm.
+	Issuer string `json:"issuer"`
+
+	// TokenEndpoint is the URI of the token endpoint.
+	TokenEndpoint string `json:"token_endpoint"`
+
+	// JWKSURI is the URI of the realm's public JWK set.
+	JWKSURI string `json:"jwks_uri"`
+}
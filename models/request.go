@@ -0,0 +1,62 @@
+package models
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+)
+
+// RequestInfo describes the incoming request being authorized.
+// Transport integrations store it in the context under provider.RequestInfoKey,
+// so the provider can perform checks that depend on the request itself, such as DPoP proof
+// or certificate binding verification.
+type RequestInfo struct {
+	// Scheme is the authorization scheme the token was presented with, e.g. "Bearer" or "DPoP".
+	Scheme string
+
+	// Method is the HTTP method of the request.
+	Method string
+
+	// Path is the HTTP path of the request or the full gRPC method name.
+	Path string
+
+	// PathParams contains the values captured by "{name}" segments of the matched endpoint path.
+	PathParams map[string]string
+
+	// Message is the gRPC request message. It is nil for HTTP requests.
+	Message any
+
+	// URL is the absolute URL of the request without query and fragment, e.g. "https://api.example.com/payouts".
+	URL string
+
+	// Headers contains the HTTP request headers or the gRPC request metadata.
+	Headers http.Header
+
+	// ClientCertificate is the certificate the client presented during the mutual TLS handshake, if any.
+	ClientCertificate *x509.Certificate
+}
+
+// PolicyInput contains the data an access policy is evaluated with.
+type PolicyInput struct {
+	// User is the authenticated user.
+	User User
+
+	// Claims are the verified token claims.
+	Claims *Claims
+
+	// Request describes the request being authorized.
+	Request RequestInfo
+}
+
+// Policy is an attribute-based access check attached to an endpoint rule.
+// It is evaluated after the role, scope and authentication level checks; a non-nil error denies access.
+//
+// Example:
+//
+//	Policy: func(ctx context.Context, input models.PolicyInput) error {
+//	    if input.Request.PathParams["id"] != input.User.UserID {
+//	        return errors.New("users may only edit their own profile")
+//	    }
+//	    return nil
+//	}
+type Policy func(ctx context.Context, input PolicyInput) error
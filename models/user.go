@@ -1,10 +1,36 @@
 package models
 
+// PrincipalKind represents the kind of principal a token was issued to.
+type PrincipalKind int
+
+const (
+	// PrincipalUser indicates a human user authenticated interactively.
+	PrincipalUser PrincipalKind = iota + 1
+
+	// PrincipalServiceAccount indicates a client's service account authenticated with client credentials.
+	PrincipalServiceAccount
+)
+
 // User represents the user of the system with their roles and personal information.
 type User struct {
+	// Kind indicates whether the user is a human or a service account.
+	Kind PrincipalKind
+
+	// Realm - name of the Keycloak realm that issued the token.
+	Realm string
+
+	// ClientID - identifier of the client that obtained the token.
+	ClientID string
+
 	// Roles contains a list of roles assigned to the user.
 	Roles []string
 
+	// Groups contains a list of full paths of the groups the user is a member of.
+	Groups []string
+
+	// Scopes contains a list of OAuth2 scopes granted to the token.
+	Scopes []string
+
 	// UserID - unique user identifier.
 	UserID string
 
@@ -19,4 +45,18 @@ type User struct {
 
 	// FamilyName - user's last name.
 	FamilyName string
+
+	// Attributes contains extra claims extracted with the registered claim mappings, keyed by mapping name.
+	Attributes map[string]any
+}
+
+// Attribute returns the user attribute with the given name converted to T.
+// The second result is false if the attribute is missing or has a different type.
+//
+// Example:
+//
+//	tenantID, ok := models.Attribute[string](user, "tenant_id")
+func Attribute[T any](user User, name string) (T, bool) {
+	value, ok := user.Attributes[name].(T)
+	return value, ok
 }
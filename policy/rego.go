@@ -0,0 +1,223 @@
+// Package keypolicy provides authorizers that delegate access decisions to policy-as-code engines.
+package keypolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/YATAHAKI/KeycloakAuth/impl"
+	"github.com/YATAHAKI/KeycloakAuth/metrics"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+var _ provider.AuthProvider = (*RegoProvider)(nil)
+
+// ErrNoPolicyBundle is returned when no policy bundle is configured.
+var ErrNoPolicyBundle = errors.New("policy bundle is not configured")
+
+// RegoProvider implements the AuthProvider interface on top of keyimpl.Provider: the token is verified
+// by the Keycloak provider and the access decision is made by a locally loaded OPA policy bundle.
+//
+// Registered endpoints only define which endpoints are secure and their token binding requirements;
+// roles, scopes and the other access rules are left to the policy.
+type RegoProvider struct {
+	*keyimpl.Provider
+
+	// Config
+	config *keyimpl.Config
+
+	// Prepared query of the loaded bundle
+	query atomic.Pointer[rego.PreparedEvalQuery]
+
+	// Logger
+	logger *slog.Logger
+}
+
+// Decision is the result of a policy evaluation.
+type Decision struct {
+	// Allow reports whether access is granted.
+	Allow bool
+
+	// Reasons optionally explain the decision.
+	Reasons []string
+}
+
+// NewRegoProvider creates a RegoProvider verifying tokens with base and evaluating
+// config.PolicyQuery against the bundle at config.PolicyBundle.
+//
+// The policy gets the following input document:
+//
+//	{
+//	    "claims":  {...},                                   // raw token claims
+//	    "user":    {"id": ..., "roles": [...], ...},        // user built from the claims
+//	    "request": {"method": ..., "path": ..., "headers": {...}, "params": {...}},
+//	    "method":  "GET",
+//	    "path":    "/api/users/42"
+//	}
+//
+// Example policy:
+//
+//	package keycloak.authz
+//
+//	default allow := false
+//
+//	allow if "admin" in input.user.roles
+//
+//	reasons contains "admin role required" if not allow
+func NewRegoProvider(ctx context.Context, config *keyimpl.Config, base *keyimpl.Provider) (*RegoProvider, error) {
+	p := &RegoProvider{
+		Provider: base,
+		config:   config,
+		logger:   base.Logger(),
+	}
+	if err := p.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload loads the policy bundle again and prepares the query. In case of an error,
+// the previously loaded bundle stays in use.
+func (p *RegoProvider) Reload(ctx context.Context) error {
+	if p.config.PolicyBundle == "" {
+		return ErrNoPolicyBundle
+	}
+
+	query, err := rego.New(
+		rego.Query(p.config.PolicyQuery),
+		rego.LoadBundle(p.config.PolicyBundle),
+	).PrepareForEval(ctx)
+	if err != nil {
+		p.logger.Error("Failed to load policy bundle",
+			slog.String("bundle", p.config.PolicyBundle), slog.String("err", err.Error()))
+		return fmt.Errorf("failed to load policy bundle: %w", err)
+	}
+
+	p.query.Store(&query)
+	return nil
+}
+
+// AuthorizeGRPC verifies the token and evaluates the policy for the gRPC method.
+// The decision is recorded by the Keycloak provider in its span, metrics and decision log.
+func (p *RegoProvider) AuthorizeGRPC(ctx context.Context, path, tokenString string) (models.User, error) {
+	rule, params, _ := p.Endpoint(models.SecureEndpoint{Path: path})
+	return p.RecordAuthorization(ctx, keymetrics.TransportGRPC, path, rule,
+		func(ctx context.Context) (models.User, *models.Claims, error) {
+			return p.authorize(ctx, rule, path, params, tokenString)
+		})
+}
+
+// AuthorizeHTTP verifies the token and evaluates the policy for the HTTP method and path.
+// The decision is recorded by the Keycloak provider in its span, metrics and decision log.
+func (p *RegoProvider) AuthorizeHTTP(ctx context.Context, method, path, tokenString string) (models.User, error) {
+	rule, params, _ := p.Endpoint(models.SecureEndpoint{Method: method, Path: path})
+	if rule.Method == "" {
+		rule.Method = method
+	}
+	return p.RecordAuthorization(ctx, keymetrics.TransportHTTP, method+" "+path, rule,
+		func(ctx context.Context) (models.User, *models.Claims, error) {
+			return p.authorize(ctx, rule, path, params, tokenString)
+		})
+}
+
+// authorize verifies the token and denies access unless the policy allows it.
+// Denials are reported as *models.AuthError with models.ReasonPolicyDenied, and the reasons returned by the
+// policy are included in the error.
+func (p *RegoProvider) authorize(
+	ctx context.Context,
+	rule models.EndpointInfo,
+	path string,
+	params map[string]string,
+	tokenString string,
+) (models.User, *models.Claims, error) {
+	user, claims, err := p.Authenticate(ctx, tokenString, rule)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	request := keyimpl.RequestInfo(ctx, rule.Method, path, params)
+	decision, err := p.Evaluate(ctx, models.PolicyInput{User: user, Claims: claims, Request: request})
+	if err != nil {
+		p.LogDenial(ctx, "Failed to evaluate policy", user,
+			slog.String("method", request.Method),
+			slog.String("path", path),
+			slog.String("err", err.Error()),
+		)
+		return user, claims, &models.AuthError{Reason: models.ReasonPolicyDenied, Err: err}
+	}
+
+	if !decision.Allow {
+		p.LogDenial(ctx, "Policy denied the request", user,
+			slog.String("method", request.Method),
+			slog.String("path", path),
+			slog.Any("reasons", decision.Reasons),
+		)
+		if len(decision.Reasons) == 0 {
+			return user, claims, &models.AuthError{Reason: models.ReasonPolicyDenied}
+		}
+		return user, claims, &models.AuthError{
+			Reason: models.ReasonPolicyDenied,
+			Err:    fmt.Errorf("%w: %s", models.ErrAccessDenied, strings.Join(decision.Reasons, "; ")),
+		}
+	}
+
+	return user, claims, nil
+}
+
+// Evaluate evaluates the policy query with the input document built from the policy input.
+// An undefined result denies access.
+func (p *RegoProvider) Evaluate(ctx context.Context, input models.PolicyInput) (Decision, error) {
+	query := p.query.Load()
+	if query == nil {
+		return Decision{}, ErrNoPolicyBundle
+	}
+
+	document := keyimpl.PolicyDocument(input)
+	document["method"] = input.Request.Method
+	document["path"] = input.Request.Path
+
+	results, err := query.Eval(ctx, rego.EvalInput(document))
+	if err != nil {
+		return Decision{}, err
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return Decision{}, nil
+	}
+
+	return decisionOf(results[0].Expressions[0].Value)
+}
+
+// decisionOf converts the query result, a boolean or an object with "allow" and "reasons", to a Decision.
+func decisionOf(value any) (Decision, error) {
+	switch v := value.(type) {
+	case bool:
+		return Decision{Allow: v}, nil
+	case map[string]any:
+		var decision Decision
+		if allow, ok := v["allow"]; ok {
+			decision.Allow, ok = allow.(bool)
+			if !ok {
+				return Decision{}, fmt.Errorf("policy allow must be a boolean, got %T", allow)
+			}
+		}
+		switch reasons := v["reasons"].(type) {
+		case nil:
+		case string:
+			decision.Reasons = []string{reasons}
+		case []any:
+			for _, reason := range reasons {
+				decision.Reasons = append(decision.Reasons, fmt.Sprint(reason))
+			}
+		default:
+			return Decision{}, fmt.Errorf("policy reasons must be a string or a list, got %T", reasons)
+		}
+		return decision, nil
+	default:
+		return Decision{}, fmt.Errorf("policy result must be a boolean or an object, got %T", value)
+	}
+}
@@ -0,0 +1,216 @@
+package keypolicy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"github.com/YATAHAKI/KeycloakAuth/audit"
+	"github.com/YATAHAKI/KeycloakAuth/impl"
+	"github.com/YATAHAKI/KeycloakAuth/models"
+	"github.com/YATAHAKI/KeycloakAuth/provider"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPolicy = `package keycloak.authz
+
+default allow := false
+
+allow if "admin" in input.user.roles
+
+allow if {
+	input.method == "GET"
+	input.request.params.id == input.user.id
+}
+
+reasons contains "admin role required" if not allow
+`
+
+// newTestProvider creates a Keycloak provider trusting a local issuer and returns it with a token signer.
+func newTestProvider(t *testing.T, opts ...keyimpl.Option) (*keyimpl.Config, *keyimpl.Provider, func(claims jwt.MapClaims) string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	publicKey, err := jwk.New(&key.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, publicKey.Set(jwk.KeyIDKey, "realm-key"))
+	require.NoError(t, publicKey.Set(jwk.AlgorithmKey, jwa.RS256))
+	keySet := jwk.NewSet()
+	keySet.Add(publicKey)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(keySet)
+	}))
+	t.Cleanup(server.Close)
+
+	redisClient := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { _ = redisClient.Close() })
+
+	config := &keyimpl.Config{
+		PublicJWKUri:      server.URL,
+		ClientID:          "aibolit-api",
+		RefreshJWKTimeout: time.Hour,
+		PrincipalClaim:    "sub",
+		SubjectPolicy:     "uuid4",
+		PolicyQuery:       "data.keycloak.authz",
+	}
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "realm-key"
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	return config, keyimpl.NewHTTPProvider(config, redisClient, opts...), sign
+}
+
+func userClaims(roles ...string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":                "1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "jdoe",
+		"resource_access":    map[string]any{"aibolit-api": map[string]any{"roles": roles}},
+	}
+}
+
+func TestRegoProvider_AuthorizeHTTP(t *testing.T) {
+	config, base, sign := newTestProvider(t)
+	config.PolicyBundle = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(config.PolicyBundle, "authz.rego"), []byte(testPolicy), 0o600))
+
+	p, err := NewRegoProvider(context.Background(), config, base)
+	require.NoError(t, err)
+	require.NoError(t, p.RegisterEndpoint(models.EndpointInfo{Method: http.MethodGet, Path: "/api/users/{id}"}))
+
+	ctx := context.WithValue(context.Background(), provider.RequestInfoKey, models.RequestInfo{Method: http.MethodGet})
+
+	user, err := p.AuthorizeHTTP(ctx, http.MethodGet, "/api/users/42", sign(userClaims("admin")))
+	require.NoError(t, err)
+	assert.Equal(t, "jdoe", user.Username)
+
+	_, err = p.AuthorizeHTTP(ctx, http.MethodGet, "/api/users/1b1f3a9e-6d3c-4c6a-9f0e-3b1d2c4e5f60", sign(userClaims("user")))
+	require.NoError(t, err)
+
+	_, err = p.AuthorizeHTTP(ctx, http.MethodGet, "/api/users/42", sign(userClaims("user")))
+	require.ErrorIs(t, err, models.ErrAccessDenied)
+	assert.Contains(t, err.Error(), "admin role required")
+
+	expired := userClaims("admin")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	_, err = p.AuthorizeHTTP(ctx, http.MethodGet, "/api/users/42", sign(expired))
+	require.ErrorIs(t, err, models.ErrInvalidToken)
+}
+
+func TestRegoProvider_DecisionLog(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []keyaudit.Event
+	)
+	sink := keyaudit.SinkFunc(func(_ context.Context, event keyaudit.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		return nil
+	})
+
+	config, base, sign := newTestProvider(t, keyimpl.WithDecisionLog(sink))
+	config.PolicyBundle = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(config.PolicyBundle, "authz.rego"), []byte(testPolicy), 0o600))
+
+	p, err := NewRegoProvider(context.Background(), config, base)
+	require.NoError(t, err)
+	require.NoError(t, p.RegisterEndpoint(models.EndpointInfo{Method: http.MethodGet, Path: "/api/users/{id}"}))
+
+	_, err = p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/users/42", sign(userClaims("admin")))
+	require.NoError(t, err)
+	_, err = p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/users/42", sign(userClaims("user")))
+	require.ErrorIs(t, err, models.ErrAccessDenied)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, events, 2)
+	assert.Equal(t, keyaudit.DecisionAllowed, events[0].Decision)
+	assert.Equal(t, "http", events[0].Transport)
+	assert.Equal(t, "GET /api/users/42", events[0].Endpoint)
+	assert.Equal(t, keyaudit.DecisionDenied, events[1].Decision)
+	assert.Equal(t, string(models.ReasonPolicyDenied), events[1].Reason)
+}
+
+func TestRegoProvider_DenialLogging(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	config, base, sign := newTestProvider(t, keyimpl.WithLogger(logger), keyimpl.WithDenialLogLevel(slog.LevelDebug))
+	config.PolicyBundle = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(config.PolicyBundle, "authz.rego"), []byte(testPolicy), 0o600))
+
+	p, err := NewRegoProvider(context.Background(), config, base)
+	require.NoError(t, err)
+
+	_, err = p.AuthorizeHTTP(context.Background(), http.MethodGet, "/api/users/42", sign(userClaims("user")))
+	require.ErrorIs(t, err, models.ErrAccessDenied)
+
+	var record map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+		require.NoError(t, json.Unmarshal(line, &record))
+		if record["msg"] == "Policy denied the request" {
+			break
+		}
+	}
+	assert.Equal(t, "Policy denied the request", record["msg"])
+	assert.Equal(t, "DEBUG", record["level"], "denial level is used")
+	assert.Equal(t, "GET", record["method"])
+	assert.Equal(t, "/api/users/42", record["path"])
+	assert.Equal(t, []any{"admin role required"}, record["reasons"])
+	assert.Contains(t, record, "user")
+	assert.NotContains(t, logs.String(), "jdoe", "user is redacted")
+}
+
+func TestRegoProvider_Reload(t *testing.T) {
+	config, base, _ := newTestProvider(t)
+
+	_, err := NewRegoProvider(context.Background(), config, base)
+	require.ErrorIs(t, err, ErrNoPolicyBundle)
+
+	config.PolicyBundle = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(config.PolicyBundle, "authz.rego"), []byte("package keycloak.authz\n\nallow := true\n"), 0o600))
+	p, err := NewRegoProvider(context.Background(), config, base)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(config.PolicyBundle, "authz.rego"), []byte("package keycloak.authz\n\nallow if {"), 0o600))
+	require.Error(t, p.Reload(context.Background()))
+
+	decision, err := p.Evaluate(context.Background(), models.PolicyInput{})
+	require.NoError(t, err)
+	assert.True(t, decision.Allow, "previous bundle stays in use")
+}
+
+func TestDecisionOf(t *testing.T) {
+	decision, err := decisionOf(true)
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Allow: true}, decision)
+
+	decision, err = decisionOf(map[string]any{"allow": false, "reasons": []any{"a", "b"}})
+	require.NoError(t, err)
+	assert.Equal(t, Decision{Reasons: []string{"a", "b"}}, decision)
+
+	_, err = decisionOf("yes")
+	require.Error(t, err)
+}
@@ -8,6 +8,14 @@ import (
 // UserDetailsKey is the key used for storing user details in the context.
 const UserDetailsKey = "UserDetails"
 
+// AccessTokenKey is the key used for storing the verified access token string in the context.
+// It allows outbound clients to propagate the caller's token.
+const AccessTokenKey = "AccessToken"
+
+// RequestInfoKey is the key used for storing models.RequestInfo of the incoming request in the context.
+// Transport integrations set it before authorization to enable request-bound checks such as DPoP.
+const RequestInfoKey = "RequestInfo"
+
 // AuthProvider defines the methods required for authentication and authorization.
 type AuthProvider interface {
 	// AuthorizeGRPC checks if a user is authorized to access a given path with the provided JWT token.